@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"log"
+	"os"
 	"os/signal"
 	"sync"
 	"syscall"
@@ -10,10 +11,17 @@ import (
 
 	"orders-service/internal/app/service"
 	"orders-service/internal/cache"
+	"orders-service/internal/codec"
 	"orders-service/internal/configs"
+	"orders-service/internal/consumer"
 	"orders-service/internal/db"
 	"orders-service/internal/http"
 	"orders-service/internal/kafka"
+	"orders-service/internal/outbox"
+	"orders-service/internal/replay"
+	"orders-service/internal/rules"
+	"orders-service/internal/source"
+	"orders-service/internal/source/spool"
 
 	"go.uber.org/zap"
 )
@@ -38,20 +46,117 @@ func main() {
 	}
 	defer database.Close()
 
-	orderCache, err := cache.NewCache(context.Background(), database, cfg.CacheSize)
+	if cfg.Outbox.Topic != "" {
+		database.EnableOutbox()
+	}
+
+	cacheLimit := cache.Limit{Entries: cfg.CacheSize, Bytes: cfg.CacheMaxBytes}
+	cachePolicy, err := cache.NewPolicy(cfg.CachePolicy, cacheLimit)
+	if err != nil {
+		logger.Fatal("Failed to create cache policy", zap.Error(err))
+	}
+	orderCache := cache.NewCache(cacheLimit, cachePolicy, cfg.CacheTTL)
+	if err := orderCache.Populate(context.Background(), database); err != nil {
+		logger.Fatal("Failed to populate cache", zap.Error(err))
+	}
+	cacheStats := orderCache.Stats()
+	logger.Info("Cache populated",
+		zap.Int("entries", cacheStats.Entries),
+		zap.Int64("bytes", cacheStats.Bytes),
+	)
+
+	decoder, err := codec.NewRegistry(cfg.AvroSchemaDir)
 	if err != nil {
-		logger.Fatal("Failed to create cache", zap.Error(err))
+		logger.Fatal("Failed to load message schemas", zap.Error(err))
 	}
+	logger.Info("Message schemas loaded", zap.Ints("avro_versions", decoder.AvroVersions()))
 
-	orderService := service.NewOrderService(database, orderCache)
+	profiles := make(map[string]service.ValidationProfile, len(cfg.Topics))
+	for _, topic := range cfg.Topics {
+		profiles[topic.Name] = service.ValidationProfile(topic.ValidationProfile)
+		if topic.MappingFile != "" {
+			mapping, err := codec.LoadMapping(topic.MappingFile)
+			if err != nil {
+				logger.Fatal("Failed to load topic mapping", zap.Error(err), zap.String("topic", topic.Name))
+			}
+			decoder.MapTopic(topic.Name, mapping)
+		}
+		logger.Info("Order topic configured",
+			zap.String("topic", topic.Name),
+			zap.String("mapping", topic.MappingFile),
+			zap.String("validation_profile", topic.ValidationProfile),
+		)
+	}
+
+	validation := service.Validation{
+		Profiles: profiles,
+		Financial: service.FinancialRules{
+			GoodsTotal:      service.RuleMode(cfg.GoodsTotalRule),
+			Amount:          service.RuleMode(cfg.AmountRule),
+			ItemTotalPrice:  service.RuleMode(cfg.ItemTotalPriceRule),
+			ItemTrackNumber: service.RuleMode(cfg.ItemTrackNumberRule),
+		},
+	}
 
-	consumer, err := kafka.NewConsumer(cfg, orderService, logger)
+	if cfg.RulesFile != "" {
+		validation.Rules, err = rules.NewStore(cfg.RulesFile)
+		if err != nil {
+			logger.Fatal("Failed to load validation rules", zap.Error(err))
+		}
+		logger.Info("Validation rules loaded",
+			zap.String("file", cfg.RulesFile),
+			zap.Int("rules", validation.Rules.Current().Len()),
+		)
+	}
+
+	orderService := service.NewOrderService(database, orderCache, decoder, validation, logger)
+
+	orderSource, err := newOrderSource(cfg, database)
 	if err != nil {
-		logger.Fatal("Failed to create Kafka consumer", zap.Error(err))
+		logger.Fatal("Failed to create order source", zap.Error(err))
+	}
+
+	var dlq consumer.DeadLetterPublisher
+	if cfg.DLQTopic != "" {
+		dlq, err = kafka.NewDeadLetterWriter(cfg.Kafka)
+		if err != nil {
+			logger.Fatal("Failed to create dead-letter writer", zap.Error(err))
+		}
 	}
-	defer consumer.Close()
 
-	server, err := http.NewServer(orderService, logger)
+	orderConsumer, err := consumer.NewConsumer(cfg.Consumer, orderSource, decoder, dlq, orderService, logger)
+	if err != nil {
+		logger.Fatal("Failed to create consumer", zap.Error(err))
+	}
+	defer orderConsumer.Close()
+
+	var relay *outbox.Relay
+	if cfg.Outbox.Topic != "" {
+		outboxWriter, err := kafka.NewOutboxWriter(cfg.Kafka, cfg.Outbox)
+		if err != nil {
+			logger.Fatal("Failed to create outbox writer", zap.Error(err))
+		}
+		relay = outbox.NewRelay(cfg.Outbox, database, outboxWriter, logger)
+		defer relay.Close()
+	}
+
+	// Обработчики проверяют отсутствие воспроизведения и правил сравнением интерфейса с nil,
+	// поэтому nil указатели в них не передаются
+	var replayer http.Replayer
+	if cfg.Source.Type == configs.SourceKafka {
+		replayReader, err := kafka.NewReplayReader(cfg.Kafka)
+		if err != nil {
+			logger.Fatal("Failed to create replay reader", zap.Error(err))
+		}
+		replayer = replay.NewReplayer(replayReader, cfg.TopicNames(), decoder, orderService, logger)
+	}
+
+	var rulesStore http.RulesStore
+	if validation.Rules != nil {
+		rulesStore = validation.Rules
+	}
+
+	server, err := http.NewServer(orderService, replayer, orderConsumer, rulesStore, orderCache, cfg.App.AdminToken, logger)
 	if err != nil {
 		logger.Fatal("Failed to create HTTP server", zap.Error(err))
 	}
@@ -64,10 +169,26 @@ func main() {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		consumer.Start(ctx)
-		logger.Info("Kafka consumer has finished its work.")
+		orderConsumer.Start(ctx)
+		logger.Info("Consumer has finished its work.")
 	}()
 
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		orderCache.RunJanitor(ctx, cfg.CacheJanitorInterval)
+		logger.Info("Cache janitor has finished its work.")
+	}()
+
+	if relay != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			relay.Start(ctx)
+			logger.Info("Outbox relay has finished its work.")
+		}()
+	}
+
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
@@ -81,6 +202,14 @@ func main() {
 		}
 	}()
 
+	if validation.Rules != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reloadRulesOnHangup(ctx, validation.Rules, logger)
+		}()
+	}
+
 	logger.Info("Application is running. Press Ctrl+C to stop.")
 
 	<-ctx.Done()
@@ -93,3 +222,37 @@ func main() {
 
 	logger.Info("Application gracefully stopped.")
 }
+
+// Перечитывает правила проверки по SIGHUP. Ошибка в файле не останавливает
+// сервис: продолжают действовать прежние правила
+func reloadRulesOnHangup(ctx context.Context, store *rules.Store, logger *zap.Logger) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+			set, err := store.Reload()
+			if err != nil {
+				logger.Error("Failed to reload validation rules, keeping previous rules", zap.Error(err))
+				continue
+			}
+			logger.Info("Validation rules reloaded", zap.String("file", store.Path()), zap.Int("rules", set.Len()))
+		}
+	}
+}
+
+// Создает источник заказов, выбранный в конфиге
+func newOrderSource(cfg *configs.AppConfig, database *db.DB) (source.OrderSource, error) {
+	switch {
+	case cfg.Source.Type == configs.SourceSpool:
+		return spool.New(cfg.SpoolDir, cfg.SpoolPollInterval)
+	case cfg.OffsetStorage == configs.OffsetStoragePostgres:
+		return kafka.NewGroupSource(cfg.Kafka, database)
+	default:
+		return kafka.NewSource(cfg.Kafka)
+	}
+}
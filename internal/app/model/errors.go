@@ -0,0 +1,22 @@
+package model
+
+import "errors"
+
+// Ошибки хранилища заказов. Их возвращает любая реализация хранилища,
+// поэтому сервис и обработчики не зависят от конкретной БД
+var (
+	// Заказ с таким order_uid уже сохранен, но с другим содержимым
+	ErrOrderConflict = errors.New("order with the same order_uid but different payload already exists")
+	ErrOrderNotFound = errors.New("order not found")
+	ErrItemNotFound  = errors.New("order item not found")
+	// Отмененный заказ больше не меняется
+	ErrOrderCancelled = errors.New("order is cancelled")
+	// Оффсет сообщения уже сохранен: результат его обработки записан раньше
+	ErrAlreadyProcessed      = errors.New("message is already processed")
+	ErrFailedMessageNotFound = errors.New("failed message not found")
+
+	// Временная ошибка: хранилище недоступно или перегружено, операцию можно повторить позже
+	ErrUnavailable = errors.New("database is unavailable")
+	// Хранилище отвергло данные (например, число не помещается в столбец), повтор не поможет
+	ErrDataRejected = errors.New("data rejected by database")
+)
@@ -0,0 +1,46 @@
+package model
+
+type EventType string
+
+const (
+	EventOrderCreated   EventType = "order.created"
+	EventOrderUpdated   EventType = "order.updated"
+	EventOrderCancelled EventType = "order.cancelled"
+	// Исходящее событие: заказ сохранен в БД
+	EventOrderPersisted EventType = "order.persisted"
+)
+
+// Событие заказа из топика. В зависимости от типа заполнено одно из полей Order, Update или Cancellation
+type OrderEvent struct {
+	Type         EventType          `json:"type"`
+	OrderUID     string             `json:"order_uid"`
+	Order        *Order             `json:"order,omitempty"`
+	Update       *OrderUpdate       `json:"update,omitempty"`
+	Cancellation *OrderCancellation `json:"cancellation,omitempty"`
+}
+
+// Частичное изменение заказа: заполненные поля заменяют сохраненные значения
+type OrderUpdate struct {
+	Delivery *DeliveryUpdate    `json:"delivery,omitempty"`
+	Items    []ItemStatusUpdate `json:"items,omitempty"`
+}
+
+// Исправление адреса доставки. nil означает, что поле не меняется
+type DeliveryUpdate struct {
+	Name    *string `json:"name,omitempty"`
+	Phone   *string `json:"phone,omitempty"`
+	Zip     *string `json:"zip,omitempty"`
+	City    *string `json:"city,omitempty"`
+	Address *string `json:"address,omitempty"`
+	Region  *string `json:"region,omitempty"`
+	Email   *string `json:"email,omitempty"`
+}
+
+type ItemStatusUpdate struct {
+	ChrtID int `json:"chrt_id"`
+	Status int `json:"status"`
+}
+
+type OrderCancellation struct {
+	Reason string `json:"reason"`
+}
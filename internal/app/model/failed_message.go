@@ -0,0 +1,28 @@
+package model
+
+import "time"
+
+// Статусы сообщения в карантине
+const (
+	FailedMessagePending     = "pending"
+	FailedMessageReprocessed = "reprocessed"
+)
+
+// Сообщение из Kafka, которое не удалось обработать, вместе с исходными байтами и ошибкой
+type FailedMessage struct {
+	ID            int64  `json:"id" db:"id"`
+	Topic         string `json:"topic" db:"topic"`
+	Partition     int    `json:"partition" db:"kafka_partition"`
+	Offset        int64  `json:"offset" db:"kafka_offset"`
+	Payload       []byte `json:"-" db:"payload"`
+	ContentType   string `json:"content_type" db:"content_type"`
+	SchemaVersion int    `json:"schema_version" db:"schema_version"`
+	FailureKind   string `json:"failure_kind" db:"failure_kind"`
+	Error         string `json:"error" db:"error"`
+	// Нарушения, если сообщение не прошло проверку
+	ValidationErrors []Violation `json:"validation_errors,omitempty" db:"validation_errors"`
+	Status           string      `json:"status" db:"status"`
+	Attempts         int         `json:"attempts" db:"attempts"`
+	CreatedAt        time.Time   `json:"created_at" db:"created_at"`
+	UpdatedAt        time.Time   `json:"updated_at" db:"updated_at"`
+}
@@ -0,0 +1,49 @@
+package model
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Считает хэш содержимого заказа. Время приводится к UTC с точностью Postgres,
+// а поля, которые меняются после создания заказа, не учитываются,
+// чтобы хэш заказа, прочитанного из БД, совпадал с хэшем исходного
+func OrderHash(order *Order) (string, error) {
+	normalized := *order
+	normalized.DateCreated = order.DateCreated.UTC().Truncate(time.Microsecond)
+	normalized.Status = ""
+	normalized.CancelReason = ""
+	normalized.CancelledAt = nil
+	normalized.UpdatedAt = nil
+
+	data, err := json.Marshal(normalized)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal order for hashing: %w", err)
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Считает хэш для сравнения с заказом, сохраненным до появления payload_hash. Исходного хэша
+// у такого заказа нет, и сравнивать приходится с данными из БД, которые могли измениться
+// после сохранения, поэтому доставка и статусы товаров не учитываются. Порядок строк items
+// в БД не сохраняется, поэтому товары сортируются по chrt_id
+func LegacyOrderHash(order *Order) (string, error) {
+	normalized := *order
+	normalized.Delivery = Delivery{}
+	normalized.Items = slices.Clone(order.Items)
+	for i := range normalized.Items {
+		normalized.Items[i].Status = 0
+	}
+	slices.SortFunc(normalized.Items, func(a, b Item) int {
+		return cmp.Or(cmp.Compare(a.ChrtID, b.ChrtID), cmp.Compare(a.Rid, b.Rid))
+	})
+
+	return OrderHash(&normalized)
+}
@@ -0,0 +1,63 @@
+package model
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func newHashedOrder() *Order {
+	return &Order{
+		OrderUID:    "order-1",
+		TrackNumber: "TRACK",
+		Delivery:    Delivery{Name: "Test Testov", City: "Kiryat Mozkin", Address: "Ploshad Mira 15"},
+		Payment:     Payment{Transaction: "order-1", Currency: "USD", Amount: 1817, GoodsTotal: 634},
+		Items: []Item{
+			{ChrtID: 2, TrackNumber: "TRACK", Price: 453, Rid: "rid-2", TotalPrice: 317, Status: 202},
+			{ChrtID: 1, TrackNumber: "TRACK", Price: 453, Rid: "rid-1", TotalPrice: 317, Status: 202},
+		},
+		DateCreated: time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC),
+	}
+}
+
+func hash(t *testing.T, f func(*Order) (string, error), order *Order) string {
+	t.Helper()
+
+	h, err := f(order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+// Заказ, сохраненный до появления payload_hash и затем обновленный событиями, должен совпадать
+// с повторно доставленным исходным заказом
+func TestLegacyOrderHashIgnoresUpdates(t *testing.T) {
+	order := newHashedOrder()
+
+	stored := newHashedOrder()
+	slices.Reverse(stored.Items)
+	stored.Delivery.Address = "Lenina 1"
+	stored.Items[0].Status = 300
+	stored.Status = OrderStatusCancelled
+	now := time.Now()
+	stored.UpdatedAt = &now
+
+	if hash(t, OrderHash, stored) == hash(t, OrderHash, order) {
+		t.Fatal("OrderHash must differ for an updated order")
+	}
+	if hash(t, LegacyOrderHash, stored) != hash(t, LegacyOrderHash, order) {
+		t.Error("LegacyOrderHash differs for an updated order with reordered items")
+	}
+
+	changed := newHashedOrder()
+	changed.Items[1].Price = 500
+	if hash(t, LegacyOrderHash, changed) == hash(t, LegacyOrderHash, order) {
+		t.Error("LegacyOrderHash ignores item price")
+	}
+
+	// Исходный заказ не меняется
+	if order.Items[0].ChrtID != 2 || order.Items[0].Status != 202 || order.Delivery.Name == "" {
+		t.Errorf("LegacyOrderHash changed the order: %+v", order)
+	}
+}
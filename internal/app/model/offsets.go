@@ -0,0 +1,25 @@
+package model
+
+import "context"
+
+// Позиция сообщения в партиции источника, которая сохраняется в БД вместе с результатом его обработки
+type SourceOffset struct {
+	Group     string
+	Topic     string
+	Partition int
+	Offset    int64
+}
+
+type offsetsKey struct{}
+
+// Возвращает контекст, в котором запись результата обработки сообщений сохраняет
+// их оффсеты в той же транзакции. Так результат и оффсет фиксируются атомарно
+func WithOffsets(ctx context.Context, offsets ...SourceOffset) context.Context {
+	return context.WithValue(ctx, offsetsKey{}, offsets)
+}
+
+// Возвращает оффсеты, переданные в контексте через WithOffsets
+func OffsetsFromContext(ctx context.Context) []SourceOffset {
+	offsets, _ := ctx.Value(offsetsKey{}).([]SourceOffset)
+	return offsets
+}
@@ -0,0 +1,15 @@
+package model
+
+import "time"
+
+// Событие, записанное в outbox в одной транзакции с изменением заказа и ожидающее публикации
+type OutboxMessage struct {
+	ID        int64
+	OrderUID  string
+	EventType EventType
+	Payload   []byte
+	Attempts  int
+	CreatedAt time.Time
+	// До какого момента событие закреплено за relay, который его забрал
+	LockedUntil time.Time
+}
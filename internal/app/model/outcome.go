@@ -0,0 +1,26 @@
+package model
+
+// Результат сохранения заказа
+type SaveOutcome int
+
+const (
+	// Заказ сохранен впервые
+	OrderInserted SaveOutcome = iota + 1
+	// Точно такой же заказ уже был сохранен, повторная доставка ничего не изменила
+	OrderDuplicate
+	// Изменения применены к уже сохраненному заказу
+	OrderUpdated
+)
+
+func (o SaveOutcome) String() string {
+	switch o {
+	case OrderInserted:
+		return "inserted"
+	case OrderDuplicate:
+		return "duplicate"
+	case OrderUpdated:
+		return "updated"
+	default:
+		return "unknown"
+	}
+}
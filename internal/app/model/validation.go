@@ -0,0 +1,98 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Коды нарушений, по которым продюсер может автоматически разобрать ошибку
+const (
+	ViolationRequired    = "required"
+	ViolationPositive    = "must_be_positive"
+	ViolationMismatch    = "mismatch"
+	ViolationSumMismatch = "sum_mismatch"
+	ViolationUnsupported = "unsupported"
+	ViolationPattern     = "pattern_mismatch"
+	ViolationNotAllowed  = "not_allowed"
+	ViolationOutOfRange  = "out_of_range"
+)
+
+// Одно нарушение: путь к полю в виде JSON pointer (RFC 6901) относительно
+// заказа или изменения, например /items/2/price, код и описание
+type Violation struct {
+	Path    string `json:"path"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Все нарушения, найденные при проверке заказа
+type ValidationError struct {
+	Violations []Violation `json:"violations"`
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		parts = append(parts, fmt.Sprintf("%s: %s", v.Path, v.Message))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Добавляет нарушение. Путь собирается из частей: Add("required", "cannot be empty", "items", 2, "chrt_id")
+func (e *ValidationError) Add(code, message string, path ...any) {
+	e.Violations = append(e.Violations, Violation{Path: JSONPointer(path...), Code: code, Message: message})
+}
+
+// Возвращает ошибку, если нарушения есть, иначе nil
+func (e *ValidationError) Err() error {
+	if len(e.Violations) == 0 {
+		return nil
+	}
+	return e
+}
+
+var pointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// Собирает JSON pointer из имен полей и индексов
+func JSONPointer(path ...any) string {
+	var b strings.Builder
+	for _, token := range path {
+		b.WriteByte('/')
+		switch t := token.(type) {
+		case int:
+			b.WriteString(strconv.Itoa(t))
+		default:
+			b.WriteString(pointerEscaper.Replace(fmt.Sprint(t)))
+		}
+	}
+	return b.String()
+}
+
+var pointerUnescaper = strings.NewReplacer("~1", "/", "~0", "~")
+
+// Разбирает JSON pointer на части. Пустая строка указывает на весь документ
+func ParseJSONPointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("JSON pointer %q must start with /", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = pointerUnescaper.Replace(token)
+	}
+	return tokens, nil
+}
+
+// Возвращает нарушения из цепочки ошибок или nil, если в ней нет *ValidationError
+func Violations(err error) []Violation {
+	var verr *ValidationError
+	if errors.As(err, &verr) {
+		return verr.Violations
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package model
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestJSONPointerRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		path    []any
+		pointer string
+		tokens  []string
+	}{
+		{nil, "", nil},
+		{[]any{"items", 0, "price"}, "/items/0/price", []string{"items", "0", "price"}},
+		{[]any{"a/b", "c~d"}, "/a~1b/c~0d", []string{"a/b", "c~d"}},
+		{[]any{"~1"}, "/~01", []string{"~1"}},
+		{[]any{""}, "/", []string{""}},
+	} {
+		pointer := JSONPointer(tc.path...)
+		if pointer != tc.pointer {
+			t.Errorf("JSONPointer(%v) = %q, want %q", tc.path, pointer, tc.pointer)
+		}
+		tokens, err := ParseJSONPointer(pointer)
+		if err != nil || !slices.Equal(tokens, tc.tokens) {
+			t.Errorf("ParseJSONPointer(%q) = %q, %v, want %q", pointer, tokens, err, tc.tokens)
+		}
+	}
+
+	if _, err := ParseJSONPointer("items/0"); err == nil {
+		t.Error("pointer without leading / is accepted")
+	}
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"orders-service/internal/app/model"
+)
+
+var (
+	ErrOrderNotFound  = model.ErrOrderNotFound
+	ErrItemNotFound   = model.ErrItemNotFound
+	ErrOrderCancelled = model.ErrOrderCancelled
+)
+
+// Применяет событие заказа в зависимости от его типа
+func (s *OrderService) HandleEvent(ctx context.Context, event *model.OrderEvent) (model.SaveOutcome, error) {
+	switch event.Type {
+	case model.EventOrderCreated:
+		if event.Order == nil {
+			return 0, invalidEvent(model.ViolationRequired, fmt.Sprintf("%s event has no order", event.Type), "order")
+		}
+		if event.OrderUID != event.Order.OrderUID {
+			return 0, invalidEvent(model.ViolationMismatch,
+				fmt.Sprintf("event order_uid %q does not match order %q", event.OrderUID, event.Order.OrderUID), "order_uid")
+		}
+		return s.SaveOrder(ctx, event.Order)
+	case model.EventOrderUpdated:
+		if event.Update == nil {
+			return 0, invalidEvent(model.ViolationRequired, fmt.Sprintf("%s event has no update", event.Type), "update")
+		}
+		if err := s.UpdateOrder(ctx, event.OrderUID, event.Update); err != nil {
+			return 0, err
+		}
+		return model.OrderUpdated, nil
+	case model.EventOrderCancelled:
+		cancellation := event.Cancellation
+		if cancellation == nil {
+			cancellation = &model.OrderCancellation{}
+		}
+		return s.CancelOrder(ctx, event.OrderUID, cancellation)
+	default:
+		return 0, invalidEvent(model.ViolationUnsupported, fmt.Sprintf("unknown event type %q", event.Type), "type")
+	}
+}
+
+// Ошибка в конверте события. Путь указывается относительно конверта
+func invalidEvent(code, message string, path ...any) error {
+	verr := &model.ValidationError{}
+	verr.Add(code, message, path...)
+	return fmt.Errorf("%w: %w", ErrInvalidOrder, verr)
+}
+
+// Применяет частичное изменение заказа и обновляет его копию в кэше
+func (s *OrderService) UpdateOrder(ctx context.Context, orderUID string, update *model.OrderUpdate) error {
+	if err := s.validateUpdate(orderUID, update); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidOrder, err)
+	}
+
+	if err := s.repo.UpdateOrder(ctx, orderUID, update); err != nil {
+		return err
+	}
+
+	s.refreshCachedOrder(ctx, orderUID)
+
+	return nil
+}
+
+// Отменяет заказ и обновляет его копию в кэше. Повторная отмена возвращает OrderDuplicate
+func (s *OrderService) CancelOrder(ctx context.Context, orderUID string, cancellation *model.OrderCancellation) (model.SaveOutcome, error) {
+	if orderUID == "" {
+		return 0, invalidEvent(model.ViolationRequired, "order_uid cannot be empty", "order_uid")
+	}
+
+	outcome, err := s.repo.CancelOrder(ctx, orderUID, cancellation.Reason)
+	if err != nil {
+		return 0, err
+	}
+
+	if outcome == model.OrderUpdated {
+		s.refreshCachedOrder(ctx, orderUID)
+	}
+
+	return outcome, nil
+}
+
+// Перечитывает заказ из БД в кэш. Если перечитать не удалось, убирает заказ из кэша,
+// чтобы не отдавать устаревшую копию
+func (s *OrderService) refreshCachedOrder(ctx context.Context, orderUID string) {
+	order, err := s.repo.GetOrder(ctx, orderUID)
+	if err != nil {
+		s.cache.RemoveOrder(orderUID)
+		return
+	}
+
+	s.cacheOrder(order)
+}
+
+// Проверяет изменение заказа. Пути нарушений указываются относительно изменения
+func (s *OrderService) validateUpdate(orderUID string, update *model.OrderUpdate) error {
+	verr := &model.ValidationError{}
+
+	if orderUID == "" {
+		verr.Add(model.ViolationRequired, "order_uid cannot be empty", "order_uid")
+	}
+	if update.Delivery == nil && len(update.Items) == 0 {
+		verr.Add(model.ViolationRequired, "update contains no changes")
+	}
+
+	for i, item := range update.Items {
+		if item.ChrtID == 0 {
+			verr.Add(model.ViolationRequired, "item chrt_id cannot be zero", "items", i, "chrt_id")
+		}
+	}
+
+	return verr.Err()
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"fmt"
+
+	"orders-service/internal/app/model"
+	"orders-service/internal/configs"
+)
+
+// Что делать с заказом, который нарушает правило: configs.RuleReject, configs.RuleWarn или configs.RuleOff
+type RuleMode string
+
+// Режимы правил согласованности сумм и полей заказа
+type FinancialRules struct {
+	// goods_total равен сумме total_price товаров
+	GoodsTotal RuleMode
+	// amount равен goods_total + delivery_cost + custom_fee
+	Amount RuleMode
+	// total_price товара равен price за вычетом скидки sale в процентах
+	ItemTotalPrice RuleMode
+	// track_number товара совпадает с track_number заказа
+	ItemTrackNumber RuleMode
+}
+
+// Проверяет согласованность заказа. Нарушения правил в режиме reject
+// добавляются в verr, в режиме warn - в warnings
+func (r FinancialRules) check(order *model.Order, verr, warnings *model.ValidationError) {
+	add := func(mode RuleMode, code, message string, path ...any) {
+		switch mode {
+		case configs.RuleReject:
+			verr.Add(code, message, path...)
+		case configs.RuleWarn:
+			warnings.Add(code, message, path...)
+		}
+	}
+
+	if r.GoodsTotal != configs.RuleOff {
+		sum := 0
+		for _, item := range order.Items {
+			sum += item.TotalPrice
+		}
+		if order.Payment.GoodsTotal != sum {
+			add(r.GoodsTotal, model.ViolationSumMismatch,
+				fmt.Sprintf("payment goods_total %d does not equal sum of item total_price %d", order.Payment.GoodsTotal, sum),
+				"payment", "goods_total")
+		}
+	}
+
+	if r.Amount != configs.RuleOff {
+		expected := order.Payment.GoodsTotal + order.Payment.DeliveryCost + order.Payment.CustomFee
+		if order.Payment.Amount != expected {
+			add(r.Amount, model.ViolationSumMismatch,
+				fmt.Sprintf("payment amount %d does not equal goods_total + delivery_cost + custom_fee %d", order.Payment.Amount, expected),
+				"payment", "amount")
+		}
+	}
+
+	for i, item := range order.Items {
+		if r.ItemTotalPrice != configs.RuleOff && !totalPriceMatches(item) {
+			add(r.ItemTotalPrice, model.ViolationSumMismatch,
+				fmt.Sprintf("item total_price %d does not match price %d with %d%% sale", item.TotalPrice, item.Price, item.Sale),
+				"items", i, "total_price")
+		}
+		if r.ItemTrackNumber != configs.RuleOff && item.TrackNumber != order.TrackNumber {
+			add(r.ItemTrackNumber, model.ViolationMismatch,
+				fmt.Sprintf("item track_number %q does not match order track_number %q", item.TrackNumber, order.TrackNumber),
+				"items", i, "track_number")
+		}
+	}
+}
+
+// Цена со скидкой может быть округлена продюсером в любую сторону,
+// поэтому допускается расхождение меньше единицы
+func totalPriceMatches(item model.Item) bool {
+	diff := item.TotalPrice*100 - item.Price*(100-item.Sale)
+	return diff > -100 && diff < 100
+}
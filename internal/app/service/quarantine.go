@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"orders-service/internal/app/model"
+	"orders-service/internal/codec"
+)
+
+var (
+	ErrFailedMessageNotFound = model.ErrFailedMessageNotFound
+	// Сообщение уже успешно обработано повторно, менять или обрабатывать его еще раз нельзя
+	ErrFailedMessageResolved = errors.New("failed message is already reprocessed")
+)
+
+// Сохраняет в карантин сообщение, которое не удалось обработать
+func (s *OrderService) QuarantineMessage(ctx context.Context, msg *model.FailedMessage) error {
+	return s.repo.SaveFailedMessage(ctx, msg)
+}
+
+func (s *OrderService) ListFailedMessages(ctx context.Context, status string, limit, offset int) ([]*model.FailedMessage, error) {
+	return s.repo.ListFailedMessages(ctx, status, limit, offset)
+}
+
+func (s *OrderService) GetFailedMessage(ctx context.Context, id int64) (*model.FailedMessage, error) {
+	return s.repo.GetFailedMessage(ctx, id)
+}
+
+// Заменяет тело сообщения в карантине, например после ручного исправления заказа.
+// Исправленное тело может быть записано в другом формате, чем исходное
+func (s *OrderService) UpdateFailedMessagePayload(ctx context.Context, id int64, payload []byte, format codec.Format) error {
+	msg, err := s.repo.GetFailedMessage(ctx, id)
+	if err != nil {
+		return err
+	}
+	if msg.Status != model.FailedMessagePending {
+		return ErrFailedMessageResolved
+	}
+
+	return s.repo.UpdateFailedMessagePayload(ctx, id, payload, format.ContentType, format.SchemaVersion)
+}
+
+// Повторно применяет событие из тела сообщения в карантине и записывает результат.
+// Тело декодируется и проверяется так же, как сообщения его топика
+func (s *OrderService) ReprocessFailedMessage(ctx context.Context, id int64) (*model.FailedMessage, error) {
+	msg, err := s.repo.GetFailedMessage(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Status != model.FailedMessagePending {
+		return nil, ErrFailedMessageResolved
+	}
+
+	format := codec.Format{ContentType: msg.ContentType, SchemaVersion: msg.SchemaVersion}
+	event, saveErr := s.decoder.DecodeTopic(msg.Topic, format, msg.Payload)
+	if saveErr != nil {
+		saveErr = fmt.Errorf("%w: %w", ErrInvalidOrder, saveErr)
+	} else {
+		_, saveErr = s.HandleEvent(WithSourceTopic(ctx, msg.Topic), event)
+	}
+
+	if saveErr != nil {
+		if err := s.repo.UpdateFailedMessageStatus(ctx, id, model.FailedMessagePending, saveErr.Error(), model.Violations(saveErr)); err != nil {
+			return nil, err
+		}
+		return nil, saveErr
+	}
+
+	if err := s.repo.UpdateFailedMessageStatus(ctx, id, model.FailedMessageReprocessed, "", nil); err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetFailedMessage(ctx, id)
+}
@@ -0,0 +1,34 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"orders-service/internal/app/model"
+)
+
+// Хранилище заказов и карантина. Реализуется *db.DB, в тестах - servicetest.Repository
+type OrderRepository interface {
+	SaveOrder(ctx context.Context, order *model.Order) (model.SaveOutcome, error)
+	CheckOrder(ctx context.Context, order *model.Order) (model.SaveOutcome, error)
+	SaveOrders(ctx context.Context, orders []*model.Order) ([]model.SaveOutcome, error)
+	GetOrder(ctx context.Context, orderUID string) (*model.Order, error)
+	UpdateOrder(ctx context.Context, orderUID string, update *model.OrderUpdate) error
+	CancelOrder(ctx context.Context, orderUID, reason string) (model.SaveOutcome, error)
+
+	SaveFailedMessage(ctx context.Context, msg *model.FailedMessage) error
+	ListFailedMessages(ctx context.Context, status string, limit, offset int) ([]*model.FailedMessage, error)
+	GetFailedMessage(ctx context.Context, id int64) (*model.FailedMessage, error)
+	UpdateFailedMessagePayload(ctx context.Context, id int64, payload []byte, contentType string, schemaVersion int) error
+	UpdateFailedMessageStatus(ctx context.Context, id int64, status, errText string, violations []model.Violation) error
+}
+
+// Кэш заказов для чтения. Реализуется *cache.Cache, в тестах - servicetest.Cache
+type OrderCache interface {
+	// Добавляет заказ со сроком жизни кэша по умолчанию
+	AddOrder(order *model.Order)
+	// Добавляет заказ с собственным сроком жизни, 0 - заказ не устаревает
+	AddOrderWithTTL(order *model.Order, ttl time.Duration)
+	GetOrder(orderUID string) (*model.Order, bool)
+	RemoveOrder(orderUID string)
+}
@@ -2,87 +2,243 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"orders-service/internal/app/model"
-	"orders-service/internal/cache"
-	"orders-service/internal/db"
+	"orders-service/internal/codec"
+	"orders-service/internal/rules"
+
+	"go.uber.org/zap"
+)
+
+var (
+	// Ошибка валидации заказа: повторное сохранение такого заказа не поможет
+	ErrInvalidOrder = errors.New("invalid order")
+	// Заказ с таким order_uid уже сохранен с другим содержимым
+	ErrOrderConflict = model.ErrOrderConflict
+	// БД временно недоступна, операцию можно повторить
+	ErrUnavailable = model.ErrUnavailable
+	// БД отвергла данные заказа, повтор не поможет
+	ErrDataRejected = model.ErrDataRejected
+	// Оффсет сообщения уже сохранен в БД вместе с результатом его обработки
+	ErrAlreadyProcessed = model.ErrAlreadyProcessed
+)
+
+// Возвращает контекст, в котором запись результата обработки сообщений
+// сохраняет их оффсеты в той же транзакции
+func WithOffsets(ctx context.Context, offsets ...model.SourceOffset) context.Context {
+	return model.WithOffsets(ctx, offsets...)
+}
+
+// Наборы проверок заказа
+type ValidationProfile string
+
+const (
+	// Все проверки
+	ProfileStrict ValidationProfile = "strict"
+	// Без полей, которые маркетплейсы могут не передавать: track_number,
+	// имени получателя, транзакции оплаты и goods_total
+	ProfileRelaxed ValidationProfile = "relaxed"
 )
 
+type sourceTopicKey struct{}
+
+// Возвращает контекст, в котором заказы проверяются набором проверок топика, из которого они прочитаны
+func WithSourceTopic(ctx context.Context, topic string) context.Context {
+	return context.WithValue(ctx, sourceTopicKey{}, topic)
+}
+
+// Настройки проверки заказов
+type Validation struct {
+	// Набор проверок для заказов из топика, заказы из остальных
+	// источников проверяются набором ProfileStrict
+	Profiles  map[string]ValidationProfile
+	Financial FinancialRules
+	// Правила из файла VALIDATION_RULES_FILE, nil - файл не задан
+	Rules *rules.Store
+}
+
 type OrderService struct {
-	db    *db.DB
-	cache *cache.Cache
+	repo       OrderRepository
+	cache      OrderCache
+	decoder    *codec.Registry
+	validation Validation
+	logger     *zap.Logger
 }
 
-func NewOrderService(db *db.DB, c *cache.Cache) *OrderService {
+func NewOrderService(repo OrderRepository, cache OrderCache, decoder *codec.Registry, validation Validation, logger *zap.Logger) *OrderService {
 	return &OrderService{
-		db:    db,
-		cache: c,
+		repo:       repo,
+		cache:      cache,
+		decoder:    decoder,
+		validation: validation,
+		logger:     logger,
 	}
 }
 
-func (s *OrderService) SaveOrder(ctx context.Context, order *model.Order) error {
-	if err := s.validateOrder(order); err != nil {
-		return err
+func sourceTopic(ctx context.Context) string {
+	topic, _ := ctx.Value(sourceTopicKey{}).(string)
+	return topic
+}
+
+func (s *OrderService) profile(ctx context.Context) ValidationProfile {
+	if profile, ok := s.validation.Profiles[sourceTopic(ctx)]; ok {
+		return profile
 	}
+	return ProfileStrict
+}
 
-	if err := s.db.SaveOrder(ctx, order); err != nil {
-		return err
+// Сохраняет новый заказ в БД и кэш. Повторная доставка того же заказа не является ошибкой
+// и возвращает OrderDuplicate. В этом случае кэш не трогается: сохраненный заказ
+// мог уже измениться после создания
+func (s *OrderService) SaveOrder(ctx context.Context, order *model.Order) (model.SaveOutcome, error) {
+	if err := s.validateOrder(ctx, order); err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrInvalidOrder, err)
 	}
 
-	s.cache.AddOrder(order)
+	markCreated(order)
 
-	return nil
+	outcome, err := s.repo.SaveOrder(ctx, order)
+	if err != nil {
+		return 0, err
+	}
+
+	if outcome == model.OrderInserted {
+		s.cacheOrder(order)
+	}
+
+	return outcome, nil
+}
+
+// Проверяет заказ так же, как SaveOrder, но ничего не сохраняет: возвращает результат,
+// который получил бы SaveOrder, или ошибку валидации или конфликта
+func (s *OrderService) CheckOrder(ctx context.Context, order *model.Order) (model.SaveOutcome, error) {
+	if err := s.validateOrder(ctx, order); err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrInvalidOrder, err)
+	}
+
+	return s.repo.CheckOrder(ctx, order)
 }
 
+// Сохраняет несколько новых заказов одной транзакцией. Если хоть один заказ невалиден
+// или конфликтует с сохраненным, не сохраняется ни один, и вызывающий может
+// сохранить заказы по одному
+func (s *OrderService) SaveOrders(ctx context.Context, orders []*model.Order) ([]model.SaveOutcome, error) {
+	for _, order := range orders {
+		if err := s.validateOrder(ctx, order); err != nil {
+			return nil, fmt.Errorf("%w: order_uid %s: %w", ErrInvalidOrder, order.OrderUID, err)
+		}
+	}
+
+	for _, order := range orders {
+		markCreated(order)
+	}
+
+	outcomes, err := s.repo.SaveOrders(ctx, orders)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, order := range orders {
+		if outcomes[i] == model.OrderInserted {
+			s.cacheOrder(order)
+		}
+	}
+
+	return outcomes, nil
+}
+
+// Возвращает заказ из кэша или БД. Ошибка ErrOrderNotFound означает, что заказа нет,
+// ErrUnavailable и context.DeadlineExceeded - что БД сейчас не ответила и запрос можно повторить
 func (s *OrderService) GetOrder(ctx context.Context, orderUID string) (*model.Order, error) {
 	if order, ok := s.cache.GetOrder(orderUID); ok {
 		return order, nil
 	}
 
-	order, err := s.db.GetOrder(ctx, orderUID)
+	order, err := s.repo.GetOrder(ctx, orderUID)
 	if err != nil {
-		return nil, fmt.Errorf("getting order frob db: %w", err)
+		return nil, fmt.Errorf("getting order from db: %w", err)
 	}
 
-	s.cache.AddOrder(order)
+	s.cacheOrder(order)
 
 	return order, nil
 }
 
-// Возвращает ошибку, если в заказе нет какого-либо существенного поля
-func (s *OrderService) validateOrder(order *model.Order) error {
+// Добавляет заказ в кэш. Отмененный заказ больше не меняется (ErrOrderCancelled),
+// поэтому его копия не может устареть и хранится без срока жизни
+func (s *OrderService) cacheOrder(order *model.Order) {
+	if order.Status == model.OrderStatusCancelled {
+		s.cache.AddOrderWithTTL(order, 0)
+		return
+	}
+	s.cache.AddOrder(order)
+}
+
+// Сбрасывает поля, которые у нового заказа задает сервис, а не продюсер
+func markCreated(order *model.Order) {
+	order.Status = model.OrderStatusCreated
+	order.CancelReason = ""
+	order.CancelledAt = nil
+	order.UpdatedAt = nil
+}
+
+// Проверяет все существенные поля, согласованность сумм и правила из файла и возвращает
+// *model.ValidationError со всеми найденными нарушениями. Нарушения правил
+// в режиме предупреждения пишутся в лог и не мешают сохранению
+func (s *OrderService) validateOrder(ctx context.Context, order *model.Order) error {
+	strict := s.profile(ctx) != ProfileRelaxed
+	verr := &model.ValidationError{}
+	warnings := &model.ValidationError{}
+
 	if order.OrderUID == "" {
-		return fmt.Errorf("order_uid cannot be empty")
+		verr.Add(model.ViolationRequired, "order_uid cannot be empty", "order_uid")
 	}
-	if order.TrackNumber == "" {
-		return fmt.Errorf("track_number cannot be empty")
+	if strict && order.TrackNumber == "" {
+		verr.Add(model.ViolationRequired, "track_number cannot be empty", "track_number")
 	}
-	if order.Delivery.Name == "" {
-		return fmt.Errorf("delivery name cannot be empty")
+	if strict && order.Delivery.Name == "" {
+		verr.Add(model.ViolationRequired, "delivery name cannot be empty", "delivery", "name")
 	}
-	if order.Payment.Transaction == "" {
-		return fmt.Errorf("payment transaction cannot be empty")
+	if strict && order.Payment.Transaction == "" {
+		verr.Add(model.ViolationRequired, "payment transaction cannot be empty", "payment", "transaction")
 	}
 	if len(order.Items) == 0 {
-		return fmt.Errorf("items list cannot be empty")
+		verr.Add(model.ViolationRequired, "items list cannot be empty", "items")
 	}
 
 	if order.Payment.Amount <= 0 {
-		return fmt.Errorf("payment amount must be greater than zero")
+		verr.Add(model.ViolationPositive, "payment amount must be greater than zero", "payment", "amount")
 	}
-	if order.Payment.GoodsTotal <= 0 {
-		return fmt.Errorf("payment goods_total must be greater than zero")
+	if strict && order.Payment.GoodsTotal <= 0 {
+		verr.Add(model.ViolationPositive, "payment goods_total must be greater than zero", "payment", "goods_total")
 	}
 
-	for _, item := range order.Items {
+	for i, item := range order.Items {
 		if item.ChrtID == 0 {
-			return fmt.Errorf("item chrt_id cannot be zero")
+			verr.Add(model.ViolationRequired, "item chrt_id cannot be zero", "items", i, "chrt_id")
 		}
 		if item.Price <= 0 {
-			return fmt.Errorf("item price must be greater than zero")
+			verr.Add(model.ViolationPositive, "item price must be greater than zero", "items", i, "price")
 		}
 	}
 
-	return nil
+	s.validation.Financial.check(order, verr, warnings)
+
+	if s.validation.Rules != nil {
+		if err := s.validation.Rules.Check(order, verr, warnings); err != nil {
+			return err
+		}
+	}
+
+	if len(warnings.Violations) > 0 {
+		s.logger.Warn("Order is inconsistent, accepting it anyway",
+			zap.String("order_uid", order.OrderUID),
+			zap.String("topic", sourceTopic(ctx)),
+			zap.Any("violations", warnings.Violations),
+		)
+	}
+
+	return verr.Err()
 }
@@ -0,0 +1,333 @@
+package service_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"orders-service/internal/app/model"
+	"orders-service/internal/app/service"
+	"orders-service/internal/app/service/servicetest"
+	"orders-service/internal/codec"
+
+	"go.uber.org/zap"
+)
+
+func newService(t *testing.T, validation service.Validation) (*service.OrderService, *servicetest.Repository, *servicetest.Cache) {
+	t.Helper()
+
+	decoder, err := codec.NewRegistry("")
+	if err != nil {
+		t.Fatalf("NewRegistry: %v", err)
+	}
+
+	repo := servicetest.NewRepository()
+	cache := servicetest.NewCache()
+	return service.NewOrderService(repo, cache, decoder, validation, zap.NewNop()), repo, cache
+}
+
+func TestSaveOrderIsIdempotent(t *testing.T) {
+	svc, repo, cache := newService(t, service.Validation{})
+	ctx := context.Background()
+
+	outcome, err := svc.SaveOrder(ctx, servicetest.NewOrder("order-1"))
+	if err != nil || outcome != model.OrderInserted {
+		t.Fatalf("first SaveOrder = %v, %v; want inserted", outcome, err)
+	}
+	if _, ok := cache.Peek("order-1"); !ok {
+		t.Error("inserted order is not cached")
+	}
+
+	outcome, err = svc.SaveOrder(ctx, servicetest.NewOrder("order-1"))
+	if err != nil || outcome != model.OrderDuplicate {
+		t.Fatalf("redelivered SaveOrder = %v, %v; want duplicate", outcome, err)
+	}
+
+	changed := servicetest.NewOrder("order-1")
+	changed.Delivery.City = "Moscow"
+	if _, err := svc.SaveOrder(ctx, changed); !errors.Is(err, service.ErrOrderConflict) {
+		t.Fatalf("SaveOrder with different payload error = %v, want ErrOrderConflict", err)
+	}
+
+	orders := repo.Orders()
+	if len(orders) != 1 || orders[0].Delivery.City != "Kiryat Mozkin" {
+		t.Fatalf("stored orders = %+v, want the first version only", orders)
+	}
+}
+
+func TestSaveOrderReportsAllViolations(t *testing.T) {
+	svc, repo, _ := newService(t, service.Validation{})
+
+	order := servicetest.NewOrder("order-1")
+	order.TrackNumber = ""
+	order.Items[0].Price = 0
+	order.Payment.Amount = -1
+
+	_, err := svc.SaveOrder(context.Background(), order)
+	if !errors.Is(err, service.ErrInvalidOrder) {
+		t.Fatalf("SaveOrder error = %v, want ErrInvalidOrder", err)
+	}
+
+	got := map[string]string{}
+	for _, v := range model.Violations(err) {
+		got[v.Path] = v.Code
+	}
+	want := map[string]string{
+		"/track_number":   model.ViolationRequired,
+		"/items/0/price":  model.ViolationPositive,
+		"/payment/amount": model.ViolationPositive,
+	}
+	for path, code := range want {
+		if got[path] != code {
+			t.Errorf("violation at %s = %q, want %q (all: %v)", path, got[path], code, got)
+		}
+	}
+
+	if len(repo.Orders()) != 0 {
+		t.Error("invalid order was saved")
+	}
+}
+
+func TestRelaxedProfileAppliesToItsTopic(t *testing.T) {
+	svc, _, _ := newService(t, service.Validation{
+		Profiles: map[string]service.ValidationProfile{"marketplace": service.ProfileRelaxed},
+	})
+
+	order := servicetest.NewOrder("order-1")
+	order.TrackNumber = ""
+	order.Items[0].TrackNumber = ""
+
+	if _, err := svc.SaveOrder(service.WithSourceTopic(context.Background(), "orders"), order); !errors.Is(err, service.ErrInvalidOrder) {
+		t.Fatalf("strict topic: SaveOrder error = %v, want ErrInvalidOrder", err)
+	}
+	if _, err := svc.SaveOrder(service.WithSourceTopic(context.Background(), "marketplace"), order); err != nil {
+		t.Fatalf("relaxed topic: SaveOrder error = %v", err)
+	}
+}
+
+func TestSaveOrdersIsAtomic(t *testing.T) {
+	svc, repo, cache := newService(t, service.Validation{})
+	ctx := context.Background()
+
+	if _, err := svc.SaveOrder(ctx, servicetest.NewOrder("order-1")); err != nil {
+		t.Fatal(err)
+	}
+
+	conflicting := servicetest.NewOrder("order-1")
+	conflicting.Locale = "ru"
+	_, err := svc.SaveOrders(ctx, []*model.Order{servicetest.NewOrder("order-2"), conflicting})
+	if !errors.Is(err, service.ErrOrderConflict) {
+		t.Fatalf("SaveOrders error = %v, want ErrOrderConflict", err)
+	}
+	if len(repo.Orders()) != 1 {
+		t.Fatalf("stored %d orders after failed batch, want 1", len(repo.Orders()))
+	}
+	if _, ok := cache.Peek("order-2"); ok {
+		t.Error("order from failed batch is cached")
+	}
+
+	outcomes, err := svc.SaveOrders(ctx, []*model.Order{servicetest.NewOrder("order-2"), servicetest.NewOrder("order-1")})
+	if err != nil {
+		t.Fatalf("SaveOrders error = %v", err)
+	}
+	if outcomes[0] != model.OrderInserted || outcomes[1] != model.OrderDuplicate {
+		t.Fatalf("outcomes = %v, want [inserted duplicate]", outcomes)
+	}
+}
+
+func TestGetOrderReadsThroughCache(t *testing.T) {
+	svc, repo, cache := newService(t, service.Validation{})
+	ctx := context.Background()
+
+	if _, err := repo.SaveOrder(ctx, servicetest.NewOrder("order-1")); err != nil {
+		t.Fatal(err)
+	}
+
+	for range 2 {
+		order, err := svc.GetOrder(ctx, "order-1")
+		if err != nil || order.OrderUID != "order-1" {
+			t.Fatalf("GetOrder = %v, %v", order, err)
+		}
+	}
+	if hits, misses := cache.Stats(); hits != 1 || misses != 1 {
+		t.Errorf("cache hits/misses = %d/%d, want 1/1", hits, misses)
+	}
+
+	if _, err := svc.GetOrder(ctx, "missing"); !errors.Is(err, service.ErrOrderNotFound) {
+		t.Errorf("GetOrder of missing order error = %v, want ErrOrderNotFound", err)
+	}
+
+	repo.FailWith(service.ErrUnavailable)
+	if _, err := svc.GetOrder(ctx, "order-1"); err != nil {
+		t.Errorf("cached order is not served while repository is down: %v", err)
+	}
+	if _, err := svc.GetOrder(ctx, "order-2"); !errors.Is(err, service.ErrUnavailable) {
+		t.Errorf("GetOrder error = %v, want ErrUnavailable", err)
+	}
+}
+
+func TestEventsRefreshCachedOrder(t *testing.T) {
+	svc, _, cache := newService(t, service.Validation{})
+	ctx := context.Background()
+
+	created := &model.OrderEvent{Type: model.EventOrderCreated, OrderUID: "order-1", Order: servicetest.NewOrder("order-1")}
+	if _, err := svc.HandleEvent(ctx, created); err != nil {
+		t.Fatal(err)
+	}
+
+	city := "Kazan"
+	updated := &model.OrderEvent{
+		Type:     model.EventOrderUpdated,
+		OrderUID: "order-1",
+		Update: &model.OrderUpdate{
+			Delivery: &model.DeliveryUpdate{City: &city},
+			Items:    []model.ItemStatusUpdate{{ChrtID: 9934930, Status: 300}},
+		},
+	}
+	if outcome, err := svc.HandleEvent(ctx, updated); err != nil || outcome != model.OrderUpdated {
+		t.Fatalf("update = %v, %v", outcome, err)
+	}
+	order, _ := cache.Peek("order-1")
+	if order.Delivery.City != city || order.Items[0].Status != 300 || order.UpdatedAt == nil {
+		t.Fatalf("cached order after update = %+v", order)
+	}
+	if ttl, _ := cache.TTL("order-1"); ttl != servicetest.DefaultTTL {
+		t.Errorf("updated order cached with TTL %v, want the default", ttl)
+	}
+
+	cancelled := &model.OrderEvent{
+		Type:         model.EventOrderCancelled,
+		OrderUID:     "order-1",
+		Cancellation: &model.OrderCancellation{Reason: "customer request"},
+	}
+	if outcome, err := svc.HandleEvent(ctx, cancelled); err != nil || outcome != model.OrderUpdated {
+		t.Fatalf("cancel = %v, %v", outcome, err)
+	}
+	if outcome, err := svc.HandleEvent(ctx, cancelled); err != nil || outcome != model.OrderDuplicate {
+		t.Fatalf("repeated cancel = %v, %v; want duplicate", outcome, err)
+	}
+	order, _ = cache.Peek("order-1")
+	if order.Status != model.OrderStatusCancelled || order.CancelReason != "customer request" {
+		t.Fatalf("cached order after cancel = %+v", order)
+	}
+	if ttl, _ := cache.TTL("order-1"); ttl != 0 {
+		t.Errorf("cancelled order cached with TTL %v, want no expiry", ttl)
+	}
+
+	if _, err := svc.HandleEvent(ctx, updated); !errors.Is(err, service.ErrOrderCancelled) {
+		t.Errorf("update of cancelled order error = %v, want ErrOrderCancelled", err)
+	}
+
+	missing := &model.OrderEvent{Type: model.EventOrderUpdated, OrderUID: "missing", Update: updated.Update}
+	if _, err := svc.HandleEvent(ctx, missing); !errors.Is(err, service.ErrOrderNotFound) {
+		t.Errorf("update of missing order error = %v, want ErrOrderNotFound", err)
+	}
+}
+
+func TestOffsetsAreStoredWithResult(t *testing.T) {
+	svc, repo, _ := newService(t, service.Validation{})
+	ctx := service.WithOffsets(context.Background(), model.SourceOffset{Group: "orders", Topic: "orders", Partition: 0, Offset: 41})
+
+	if _, err := svc.SaveOrder(ctx, servicetest.NewOrder("order-1")); err != nil {
+		t.Fatal(err)
+	}
+	if next, ok := repo.Offset("orders", "orders", 0); !ok || next != 42 {
+		t.Fatalf("stored offset = %d, %v; want 42", next, ok)
+	}
+
+	// Повторная доставка после падения до коммита в брокер
+	if _, err := svc.SaveOrder(ctx, servicetest.NewOrder("order-1")); !errors.Is(err, service.ErrAlreadyProcessed) {
+		t.Fatalf("SaveOrder with stored offset error = %v, want ErrAlreadyProcessed", err)
+	}
+}
+
+func TestReprocessFailedMessage(t *testing.T) {
+	svc, repo, _ := newService(t, service.Validation{})
+	ctx := context.Background()
+
+	msg := &model.FailedMessage{
+		Topic:         "orders",
+		Offset:        7,
+		Payload:       []byte(`{"order_uid": "order-1"}`),
+		ContentType:   codec.ContentTypeJSON,
+		SchemaVersion: 1,
+		FailureKind:   "validation",
+		Error:         "invalid order",
+	}
+	if err := svc.QuarantineMessage(ctx, msg); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := svc.ReprocessFailedMessage(ctx, msg.ID); !errors.Is(err, service.ErrInvalidOrder) {
+		t.Fatalf("reprocess of invalid payload error = %v, want ErrInvalidOrder", err)
+	}
+	stored, err := svc.GetFailedMessage(ctx, msg.ID)
+	if err != nil || stored.Status != model.FailedMessagePending || len(stored.ValidationErrors) == 0 {
+		t.Fatalf("failed message after failed reprocess = %+v, %v", stored, err)
+	}
+
+	payload, err := json.Marshal(servicetest.NewOrder("order-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.UpdateFailedMessagePayload(ctx, msg.ID, payload, codec.Format{ContentType: codec.ContentTypeJSON, SchemaVersion: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	reprocessed, err := svc.ReprocessFailedMessage(ctx, msg.ID)
+	if err != nil || reprocessed.Status != model.FailedMessageReprocessed {
+		t.Fatalf("reprocess = %+v, %v", reprocessed, err)
+	}
+	if len(repo.Orders()) != 1 {
+		t.Errorf("stored %d orders after reprocess, want 1", len(repo.Orders()))
+	}
+
+	if _, err := svc.ReprocessFailedMessage(ctx, msg.ID); !errors.Is(err, service.ErrFailedMessageResolved) {
+		t.Errorf("second reprocess error = %v, want ErrFailedMessageResolved", err)
+	}
+	if _, err := svc.GetFailedMessage(ctx, 100); !errors.Is(err, service.ErrFailedMessageNotFound) {
+		t.Errorf("GetFailedMessage of missing id error = %v, want ErrFailedMessageNotFound", err)
+	}
+}
+
+func TestQuarantineKeepsMessagesWithReusedCoordinates(t *testing.T) {
+	svc, repo, _ := newService(t, service.Validation{})
+	ctx := context.Background()
+
+	// Координаты spool: имя файла и позиция в нем
+	quarantine := func(payload string) *model.FailedMessage {
+		t.Helper()
+		msg := &model.FailedMessage{
+			Topic:       "orders.ndjson",
+			Offset:      24,
+			Payload:     []byte(payload),
+			ContentType: codec.ContentTypeJSON,
+			FailureKind: "validation",
+			Error:       "invalid order",
+			Attempts:    1,
+		}
+		if err := svc.QuarantineMessage(ctx, msg); err != nil {
+			t.Fatal(err)
+		}
+		return msg
+	}
+
+	first := quarantine(`{"order_uid": "order-1"}`)
+	if redelivered := quarantine(`{"order_uid": "order-1"}`); redelivered.ID != first.ID || redelivered.Attempts != 2 {
+		t.Fatalf("redelivery = %+v, want the same record with 2 attempts", redelivered)
+	}
+	if err := repo.UpdateFailedMessageStatus(ctx, first.ID, model.FailedMessageReprocessed, "", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Новый файл с тем же именем: другое сообщение не должно потеряться
+	quarantine(`{"order_uid": "order-2"}`)
+	stored, err := svc.GetFailedMessage(ctx, first.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(stored.Payload) != `{"order_uid": "order-2"}` || stored.Status != model.FailedMessagePending || stored.Attempts != 1 {
+		t.Errorf("message with reused coordinates = %+v, want new pending payload", stored)
+	}
+}
@@ -0,0 +1,92 @@
+package servicetest
+
+import (
+	"sync"
+	"time"
+
+	"orders-service/internal/app/model"
+	"orders-service/internal/app/service"
+)
+
+var _ service.OrderCache = (*Cache)(nil)
+
+// Кэш без лимита, вытеснения и устаревания, который считает обращения. Позволяет проверить,
+// когда сервис берет заказ из кэша, а когда идет в хранилище, и с каким сроком жизни
+// он добавил заказ
+type Cache struct {
+	mu     sync.Mutex
+	orders map[string]*model.Order
+	ttls   map[string]time.Duration
+	hits   int
+	misses int
+}
+
+// Срок жизни, которым помечаются заказы, добавленные через AddOrder
+const DefaultTTL time.Duration = -1
+
+func NewCache() *Cache {
+	return &Cache{
+		orders: make(map[string]*model.Order),
+		ttls:   make(map[string]time.Duration),
+	}
+}
+
+func (c *Cache) AddOrder(order *model.Order) {
+	c.AddOrderWithTTL(order, DefaultTTL)
+}
+
+func (c *Cache) AddOrderWithTTL(order *model.Order, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.orders[order.OrderUID] = order
+	c.ttls[order.OrderUID] = ttl
+}
+
+// Возвращает срок жизни, с которым заказ добавлен в кэш, или DefaultTTL для AddOrder
+func (c *Cache) TTL(orderUID string) (time.Duration, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ttl, ok := c.ttls[orderUID]
+	return ttl, ok
+}
+
+func (c *Cache) GetOrder(orderUID string) (*model.Order, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	order, ok := c.orders[orderUID]
+	if ok {
+		c.hits++
+	} else {
+		c.misses++
+	}
+	return order, ok
+}
+
+func (c *Cache) RemoveOrder(orderUID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.orders, orderUID)
+	delete(c.ttls, orderUID)
+}
+
+// Возвращает заказ без учета обращения
+func (c *Cache) Peek(orderUID string) (*model.Order, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	order, ok := c.orders[orderUID]
+	return order, ok
+}
+
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.orders)
+}
+
+// Число обращений GetOrder, которые нашли и не нашли заказ
+func (c *Cache) Stats() (hits, misses int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits, c.misses
+}
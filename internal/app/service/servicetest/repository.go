@@ -0,0 +1,430 @@
+package servicetest
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"orders-service/internal/app/model"
+	"orders-service/internal/app/service"
+)
+
+var _ service.OrderRepository = (*Repository)(nil)
+
+type offsetKey struct {
+	group     string
+	topic     string
+	partition int
+}
+
+type failedKey struct {
+	topic     string
+	partition int
+	offset    int64
+}
+
+type storedOrder struct {
+	order *model.Order
+	hash  string
+}
+
+// Хранилище заказов в памяти с той же семантикой, что и *db.DB: идемпотентное сохранение
+// по хэшу содержимого, ErrOrderConflict, ErrOrderNotFound, атомарное сохранение пачки
+// и оффсеты из service.WithOffsets. Заказы хранятся копиями, поэтому изменение переданного
+// или полученного заказа не меняет сохраненный
+type Repository struct {
+	mu       sync.Mutex
+	orders   map[string]*storedOrder
+	failed   map[int64]*model.FailedMessage
+	failedBy map[failedKey]int64
+	nextID   int64
+	offsets  map[offsetKey]int64
+	err      error
+}
+
+func NewRepository() *Repository {
+	return &Repository{
+		orders:   make(map[string]*storedOrder),
+		failed:   make(map[int64]*model.FailedMessage),
+		failedBy: make(map[failedKey]int64),
+		offsets:  make(map[offsetKey]int64),
+	}
+}
+
+// Заставляет все следующие вызовы возвращать err, например service.ErrUnavailable.
+// nil возвращает хранилище в рабочее состояние
+func (r *Repository) FailWith(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.err = err
+}
+
+// Возвращает копии всех сохраненных заказов в порядке order_uid
+func (r *Repository) Orders() []*model.Order {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	orders := make([]*model.Order, 0, len(r.orders))
+	for _, stored := range r.orders {
+		orders = append(orders, cloneOrder(stored.order))
+	}
+	slices.SortFunc(orders, func(a, b *model.Order) int {
+		return cmp.Compare(a.OrderUID, b.OrderUID)
+	})
+	return orders
+}
+
+// Возвращает следующий оффсет партиции, сохраненный через service.WithOffsets, и false, если его нет
+func (r *Repository) Offset(group, topic string, partition int) (int64, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	next, ok := r.offsets[offsetKey{group: group, topic: topic, partition: partition}]
+	return next, ok
+}
+
+func (r *Repository) SaveOrder(ctx context.Context, order *model.Order) (model.SaveOutcome, error) {
+	outcomes, err := r.SaveOrders(ctx, []*model.Order{order})
+	if err != nil {
+		return 0, err
+	}
+	return outcomes[0], nil
+}
+
+func (r *Repository) CheckOrder(ctx context.Context, order *model.Order) (model.SaveOutcome, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err != nil {
+		return 0, r.err
+	}
+	return r.compare(order, nil)
+}
+
+// Сохраняет заказы атомарно: при конфликте хотя бы одного заказа не сохраняется ни один
+func (r *Repository) SaveOrders(ctx context.Context, orders []*model.Order) ([]model.SaveOutcome, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.checkOffsets(ctx); err != nil {
+		return nil, err
+	}
+
+	outcomes := make([]model.SaveOutcome, len(orders))
+	inserted := make(map[string]*storedOrder)
+	for i, order := range orders {
+		outcome, err := r.compare(order, inserted)
+		if err != nil {
+			return nil, err
+		}
+		outcomes[i] = outcome
+		if outcome == model.OrderInserted {
+			hash, err := model.OrderHash(order)
+			if err != nil {
+				return nil, err
+			}
+			inserted[order.OrderUID] = &storedOrder{order: cloneOrder(order), hash: hash}
+		}
+	}
+
+	for uid, stored := range inserted {
+		r.orders[uid] = stored
+	}
+	r.storeOffsets(ctx)
+
+	return outcomes, nil
+}
+
+// Сравнивает заказ с сохраненным и с заказами, добавленными в той же пачке
+func (r *Repository) compare(order *model.Order, pending map[string]*storedOrder) (model.SaveOutcome, error) {
+	hash, err := model.OrderHash(order)
+	if err != nil {
+		return 0, err
+	}
+
+	stored, ok := r.orders[order.OrderUID]
+	if !ok {
+		stored, ok = pending[order.OrderUID]
+	}
+	switch {
+	case !ok:
+		return model.OrderInserted, nil
+	case stored.hash != hash:
+		return 0, fmt.Errorf("%w: order_uid %s", service.ErrOrderConflict, order.OrderUID)
+	default:
+		return model.OrderDuplicate, nil
+	}
+}
+
+func (r *Repository) GetOrder(_ context.Context, orderUID string) (*model.Order, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err != nil {
+		return nil, r.err
+	}
+	stored, ok := r.orders[orderUID]
+	if !ok {
+		return nil, fmt.Errorf("%w: order_uid %s", service.ErrOrderNotFound, orderUID)
+	}
+	return cloneOrder(stored.order), nil
+}
+
+// Возвращает последние по date_created заказы в том же порядке, что *db.DB. Нужен для cache.Cache.Populate
+func (r *Repository) GetRecentOrders(_ context.Context, limit, offset int) ([]*model.Order, error) {
+	r.mu.Lock()
+	err := r.err
+	r.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	orders := r.Orders()
+	slices.SortStableFunc(orders, func(a, b *model.Order) int {
+		return b.DateCreated.Compare(a.DateCreated)
+	})
+	orders = orders[min(offset, len(orders)):]
+	return orders[:min(limit, len(orders))], nil
+}
+
+func (r *Repository) UpdateOrder(ctx context.Context, orderUID string, update *model.OrderUpdate) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.checkOffsets(ctx); err != nil {
+		return err
+	}
+
+	stored, ok := r.orders[orderUID]
+	if !ok {
+		return fmt.Errorf("%w: order_uid %s", service.ErrOrderNotFound, orderUID)
+	}
+	if stored.order.Status == model.OrderStatusCancelled {
+		return fmt.Errorf("%w: order_uid %s", service.ErrOrderCancelled, orderUID)
+	}
+
+	// Изменения применяются к копии, чтобы при ошибке сохраненный заказ остался прежним
+	order := cloneOrder(stored.order)
+	if d := update.Delivery; d != nil {
+		setIfNotNil(&order.Delivery.Name, d.Name)
+		setIfNotNil(&order.Delivery.Phone, d.Phone)
+		setIfNotNil(&order.Delivery.Zip, d.Zip)
+		setIfNotNil(&order.Delivery.City, d.City)
+		setIfNotNil(&order.Delivery.Address, d.Address)
+		setIfNotNil(&order.Delivery.Region, d.Region)
+		setIfNotNil(&order.Delivery.Email, d.Email)
+	}
+	for _, itemUpdate := range update.Items {
+		i := slices.IndexFunc(order.Items, func(item model.Item) bool { return item.ChrtID == itemUpdate.ChrtID })
+		if i < 0 {
+			return fmt.Errorf("%w: order_uid %s, chrt_id %d", service.ErrItemNotFound, orderUID, itemUpdate.ChrtID)
+		}
+		order.Items[i].Status = itemUpdate.Status
+	}
+	now := time.Now()
+	order.UpdatedAt = &now
+
+	stored.order = order
+	r.storeOffsets(ctx)
+
+	return nil
+}
+
+func (r *Repository) CancelOrder(ctx context.Context, orderUID, reason string) (model.SaveOutcome, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.checkOffsets(ctx); err != nil {
+		return 0, err
+	}
+
+	stored, ok := r.orders[orderUID]
+	if !ok {
+		return 0, fmt.Errorf("%w: order_uid %s", service.ErrOrderNotFound, orderUID)
+	}
+	defer r.storeOffsets(ctx)
+
+	if stored.order.Status == model.OrderStatusCancelled {
+		return model.OrderDuplicate, nil
+	}
+
+	now := time.Now()
+	stored.order.Status = model.OrderStatusCancelled
+	stored.order.CancelReason = reason
+	stored.order.CancelledAt = &now
+	stored.order.UpdatedAt = &now
+
+	return model.OrderUpdated, nil
+}
+
+// Сохраняет сообщение в карантин. Повторное сообщение с тем же оффсетом обновляет запись
+func (r *Repository) SaveFailedMessage(ctx context.Context, msg *model.FailedMessage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.checkOffsets(ctx); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	key := failedKey{topic: msg.Topic, partition: msg.Partition, offset: msg.Offset}
+	if id, ok := r.failedBy[key]; ok {
+		stored := r.failed[id]
+		if bytes.Equal(stored.Payload, msg.Payload) {
+			stored.Attempts += msg.Attempts
+		} else {
+			stored.Payload = slices.Clone(msg.Payload)
+			stored.ContentType = msg.ContentType
+			stored.SchemaVersion = msg.SchemaVersion
+			stored.Status = model.FailedMessagePending
+			stored.Attempts = msg.Attempts
+		}
+		stored.FailureKind = msg.FailureKind
+		stored.Error = msg.Error
+		stored.ValidationErrors = slices.Clone(msg.ValidationErrors)
+		stored.UpdatedAt = now
+		*msg = *cloneFailedMessage(stored)
+	} else {
+		r.nextID++
+		msg.ID = r.nextID
+		msg.Status = model.FailedMessagePending
+		msg.CreatedAt = now
+		msg.UpdatedAt = now
+		r.failed[msg.ID] = cloneFailedMessage(msg)
+		r.failedBy[key] = msg.ID
+	}
+	r.storeOffsets(ctx)
+
+	return nil
+}
+
+func (r *Repository) ListFailedMessages(_ context.Context, status string, limit, offset int) ([]*model.FailedMessage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	var messages []*model.FailedMessage
+	for _, msg := range r.failed {
+		if status == "" || msg.Status == status {
+			messages = append(messages, cloneFailedMessage(msg))
+		}
+	}
+	slices.SortFunc(messages, func(a, b *model.FailedMessage) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+
+	offset = min(offset, len(messages))
+	return messages[offset:min(offset+limit, len(messages))], nil
+}
+
+func (r *Repository) GetFailedMessage(_ context.Context, id int64) (*model.FailedMessage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err != nil {
+		return nil, r.err
+	}
+	msg, ok := r.failed[id]
+	if !ok {
+		return nil, service.ErrFailedMessageNotFound
+	}
+	return cloneFailedMessage(msg), nil
+}
+
+func (r *Repository) UpdateFailedMessagePayload(_ context.Context, id int64, payload []byte, contentType string, schemaVersion int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err != nil {
+		return r.err
+	}
+	msg, ok := r.failed[id]
+	if !ok {
+		return service.ErrFailedMessageNotFound
+	}
+	msg.Payload = slices.Clone(payload)
+	msg.ContentType = contentType
+	msg.SchemaVersion = schemaVersion
+	msg.UpdatedAt = time.Now()
+	return nil
+}
+
+// При пустой ошибке сохраняются предыдущие ошибка и нарушения, как в *db.DB
+func (r *Repository) UpdateFailedMessageStatus(_ context.Context, id int64, status, errText string, violations []model.Violation) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err != nil {
+		return r.err
+	}
+	msg, ok := r.failed[id]
+	if !ok {
+		return service.ErrFailedMessageNotFound
+	}
+	msg.Status = status
+	if errText != "" {
+		msg.Error = errText
+		msg.ValidationErrors = slices.Clone(violations)
+	}
+	msg.Attempts++
+	msg.UpdatedAt = time.Now()
+	return nil
+}
+
+// Проверяет ошибку, заданную FailWith, и то, что оффсеты из контекста еще не сохранены.
+// Вызывается под r.mu до изменения данных
+func (r *Repository) checkOffsets(ctx context.Context) error {
+	if r.err != nil {
+		return r.err
+	}
+	for _, o := range model.OffsetsFromContext(ctx) {
+		key := offsetKey{group: o.Group, topic: o.Topic, partition: o.Partition}
+		if next, ok := r.offsets[key]; ok && next >= o.Offset+1 {
+			return fmt.Errorf("%w: %s/%d offset %d", service.ErrAlreadyProcessed, o.Topic, o.Partition, o.Offset)
+		}
+	}
+	return nil
+}
+
+// Сдвигает оффсеты из контекста вместе с успешно записанным результатом
+func (r *Repository) storeOffsets(ctx context.Context) {
+	for _, o := range model.OffsetsFromContext(ctx) {
+		r.offsets[offsetKey{group: o.Group, topic: o.Topic, partition: o.Partition}] = o.Offset + 1
+	}
+}
+
+func setIfNotNil(dst *string, value *string) {
+	if value != nil {
+		*dst = *value
+	}
+}
+
+// Копирует заказ так, чтобы копия не разделяла с ним товары и время изменений
+func cloneOrder(order *model.Order) *model.Order {
+	clone := *order
+	clone.Items = slices.Clone(order.Items)
+	clone.CancelledAt = cloneTime(order.CancelledAt)
+	clone.UpdatedAt = cloneTime(order.UpdatedAt)
+	return &clone
+}
+
+func cloneTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	clone := *t
+	return &clone
+}
+
+func cloneFailedMessage(msg *model.FailedMessage) *model.FailedMessage {
+	clone := *msg
+	clone.Payload = slices.Clone(msg.Payload)
+	clone.ValidationErrors = slices.Clone(msg.ValidationErrors)
+	return &clone
+}
@@ -0,0 +1,25 @@
+package backoff
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// Экспоненциальная задержка между повторными попытками с потолком
+type Exponential struct {
+	Initial time.Duration
+	Max     time.Duration
+}
+
+// Возвращает задержку после attempt-й неудачной попытки (с 1): удваивается от Initial до Max,
+// а случайный разброс в половину задержки не дает повторять запросы одновременно
+func (b Exponential) Delay(attempt int) time.Duration {
+	d := b.Initial
+	for i := 1; i < attempt && d < b.Max; i++ {
+		d *= 2
+	}
+	d = min(d, b.Max)
+
+	half := d / 2
+	return half + rand.N(half+1)
+}
@@ -0,0 +1,27 @@
+package backoff
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExponentialDelay(t *testing.T) {
+	b := Exponential{Initial: 100 * time.Millisecond, Max: time.Second}
+
+	for _, tc := range []struct {
+		attempt int
+		base    time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{50, time.Second},
+	} {
+		for range 100 {
+			if d := b.Delay(tc.attempt); d < tc.base/2 || d > tc.base {
+				t.Fatalf("Delay(%d) = %v, want within [%v, %v]", tc.attempt, d, tc.base/2, tc.base)
+			}
+		}
+	}
+}
@@ -3,73 +3,239 @@ package cache
 import (
 	"context"
 	"sync"
+	"time"
 
 	"orders-service/internal/app/model"
-	"orders-service/internal/db"
 )
 
+// Источник заказов для заполнения кэша при запуске, например *db.DB
+type OrderLoader interface {
+	GetRecentOrders(ctx context.Context, limit, offset int) ([]*model.Order, error)
+}
+
+// Сколько заказов Populate запрашивает у loader за раз
+const populatePageSize = 500
+
+// Кэш заказов. Какие заказы остаются в кэше при переполнении, решает политика вытеснения.
+// Политики меняют свое состояние и при чтении, поэтому и GetOrder, и AddOrder берут
+// обычную блокировку, а не RLock. Все операции выполняются за O(1) и держат ее недолго.
+// Заказ с истекшим сроком жизни не возвращается из кэша, а удаляет его GetOrder или RunJanitor.
+// Размер кэша ограничен числом заказов, их оценочным размером в байтах или и тем, и другим
 type Cache struct {
-	mu      sync.RWMutex
-	orders  map[string]*model.Order
-	db      *db.DB
-	maxSize int
+	mu     sync.Mutex
+	orders map[string]entry
+	policy Policy
+	limit  Limit
+	ttl    time.Duration
+	// Суммарный оценочный размер заказов в кэше
+	bytes int64
+	// Сколько заказов в кэше имеют срок жизни. Пока их нет, очистке нечего делать
+	expiring int
 }
 
-// Создает кеш с указанным лимитом и заполняет его данными из БД
-func NewCache(ctx context.Context, db *db.DB, maxSize int) (*Cache, error) {
-	cache := &Cache{
-		orders:  make(map[string]*model.Order, maxSize),
-		db:      db,
-		maxSize: maxSize,
-	}
+type entry struct {
+	order *model.Order
+	size  int64
+	// Нулевое время - заказ не устаревает
+	expiresAt time.Time
+}
 
-	if err := cache.PopulateFromDB(ctx); err != nil {
-		return nil, err
-	}
+func (e entry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && !now.Before(e.expiresAt)
+}
 
-	return cache, nil
+// Создает пустой кэш с указанным ограничением. policy должна быть создана для того же ограничения.
+// ttl - срок жизни заказов, добавленных через AddOrder, 0 - заказы не устаревают
+func NewCache(limit Limit, policy Policy, ttl time.Duration) *Cache {
+	return &Cache{
+		orders: make(map[string]entry, limit.Entries),
+		policy: policy,
+		limit:  limit,
+		ttl:    ttl,
+	}
 }
 
-// Заполняет кэш данными из БД
-func (c *Cache) PopulateFromDB(ctx context.Context) error {
-	orders, err := c.db.GetRecentOrders(ctx, c.maxSize)
+// Заполняет кэш последними заказами из loader
+func (c *Cache) Populate(ctx context.Context, loader OrderLoader) error {
+	orders, err := c.loadRecent(ctx, loader)
 	if err != nil {
 		return err
 	}
 
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	for _, order := range orders {
-		c.orders[order.OrderUID] = order
+	// Заказы приходят от новых к старым, а добавленный последним считается самым свежим
+	for i := len(orders) - 1; i >= 0; i-- {
+		c.AddOrder(orders[i])
 	}
 
 	return nil
 }
 
-// Добавляет заказ в кэш
+// Читает заказы порциями от новых к старым, пока не наберется ограничение кэша
+// по числу заказов или по байтам либо пока заказы не закончатся
+func (c *Cache) loadRecent(ctx context.Context, loader OrderLoader) ([]*model.Order, error) {
+	var (
+		orders  []*model.Order
+		bytes   int64
+		fetched int
+	)
+	for {
+		limit := populatePageSize
+		if c.limit.Entries > 0 {
+			limit = min(limit, c.limit.Entries-len(orders))
+		}
+
+		page, err := loader.GetRecentOrders(ctx, limit, fetched)
+		if err != nil {
+			return nil, err
+		}
+		fetched += len(page)
+
+		for _, order := range page {
+			size := estimateSize(order)
+			if c.limit.Bytes > 0 && bytes+size > c.limit.Bytes {
+				return orders, nil
+			}
+			orders = append(orders, order)
+			bytes += size
+		}
+
+		if len(page) < limit || len(orders) == c.limit.Entries {
+			return orders, nil
+		}
+	}
+}
+
+// Добавляет заказ в кэш со сроком жизни по умолчанию
 func (c *Cache) AddOrder(order *model.Order) {
+	c.AddOrderWithTTL(order, c.ttl)
+}
+
+// Добавляет заказ в кэш или заменяет уже добавленный, срок жизни отсчитывается заново.
+// ttl 0 - заказ не устаревает. Если кэш переполнен, политика вытесняет другие заказы,
+// пока кэш не уложится в ограничение, или не допускает в кэш сам добавляемый
+func (c *Cache) AddOrderWithTTL(order *model.Order, ttl time.Duration) {
+	e := entry{order: order, size: estimateSize(order)}
+	if ttl > 0 {
+		e.expiresAt = time.Now().Add(ttl)
+	}
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	if len(c.orders) >= c.maxSize {
-		c.EvictElement()
+	if old, ok := c.orders[order.OrderUID]; ok {
+		c.drop(order.OrderUID, old)
+	}
+	c.orders[order.OrderUID] = e
+	c.bytes += e.size
+	if !e.expiresAt.IsZero() {
+		c.expiring++
+	}
+
+	for _, uid := range c.policy.Add(order.OrderUID, e.size) {
+		if evicted, ok := c.orders[uid]; ok {
+			c.drop(uid, evicted)
+		}
 	}
-	c.orders[order.OrderUID] = order
 }
 
-// Возвращает структуру с заказом и bool, было ли что-то в кэше по переданному uid
+// Возвращает заказ и bool, был ли он в кэше. Обращение учитывается политикой и при промахе.
+// Устаревший заказ удаляется и считается промахом
 func (c *Cache) GetOrder(orderUID string) (*model.Order, bool) {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-	order, ok := c.orders[orderUID]
-	return order, ok
-}
-
-// Удаляет элемент из кэша
-func (c *Cache) EvictElement() {
-	// Лучше конечно сделать LRU кэш, но пока как есть
-	for uid := range c.orders {
-		delete(c.orders, uid)
-		break
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.policy.Access(orderUID)
+	e, ok := c.orders[orderUID]
+	if !ok {
+		return nil, false
+	}
+	if e.expired(time.Now()) {
+		c.remove(orderUID)
+		return nil, false
+	}
+	return e.order, true
+}
+
+// Удаляет заказ из кэша, если он там есть
+func (c *Cache) RemoveOrder(orderUID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.orders[orderUID]; ok {
+		c.remove(orderUID)
+	}
+}
+
+// Вызывается под c.mu
+func (c *Cache) remove(orderUID string) {
+	c.drop(orderUID, c.orders[orderUID])
+	c.policy.Remove(orderUID)
+}
+
+// Убирает заказ из кэша без политики, например когда она сама его вытеснила. Вызывается под c.mu
+func (c *Cache) drop(orderUID string, e entry) {
+	c.bytes -= e.size
+	if !e.expiresAt.IsZero() {
+		c.expiring--
+	}
+	delete(c.orders, orderUID)
+}
+
+// Раз в interval удаляет устаревшие заказы, пока не отменен ctx. Без этого устаревший заказ,
+// который больше не запрашивают, занимал бы место до вытеснения политикой. Срок жизни
+// может быть задан отдельному заказу и без ttl по умолчанию, поэтому очистка запускается
+// всегда, а пока устаревать нечему, ничего не перебирает
+func (c *Cache) RunJanitor(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.removeExpired()
+		}
+	}
+}
+
+func (c *Cache) removeExpired() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.expiring == 0 {
+		return
+	}
+
+	now := time.Now()
+	for uid, e := range c.orders {
+		if e.expired(now) {
+			c.remove(uid)
+		}
+	}
+}
+
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.orders)
+}
+
+// Заполненность кэша для мониторинга. 0 в ограничении - ограничения нет
+type Stats struct {
+	Entries    int   `json:"entries"`
+	Bytes      int64 `json:"bytes"`
+	MaxEntries int   `json:"max_entries"`
+	MaxBytes   int64 `json:"max_bytes"`
+}
+
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return Stats{
+		Entries:    len(c.orders),
+		Bytes:      c.bytes,
+		MaxEntries: c.limit.Entries,
+		MaxBytes:   c.limit.Bytes,
 	}
 }
@@ -0,0 +1,211 @@
+package cache_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"orders-service/internal/app/model"
+	"orders-service/internal/app/service"
+	"orders-service/internal/app/service/servicetest"
+	"orders-service/internal/cache"
+)
+
+func newCache(t *testing.T, limit cache.Limit) *cache.Cache {
+	t.Helper()
+
+	policy, err := cache.NewPolicy(cache.PolicyLRU, limit)
+	if err != nil {
+		t.Fatalf("NewPolicy: %v", err)
+	}
+	return cache.NewCache(limit, policy, 0)
+}
+
+func TestPopulateLoadsMostRecentOrders(t *testing.T) {
+	repo := servicetest.NewRepository()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := range 5 {
+		order := servicetest.NewOrder(fmt.Sprintf("order-%d", i))
+		order.DateCreated = start.Add(time.Duration(i) * time.Hour)
+		if _, err := repo.SaveOrder(context.Background(), order); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := newCache(t, cache.Limit{Entries: 3})
+	if err := c.Populate(context.Background(), repo); err != nil {
+		t.Fatalf("Populate: %v", err)
+	}
+
+	if c.Len() != 3 {
+		t.Fatalf("Len = %d, want 3", c.Len())
+	}
+	for i := range 5 {
+		uid := fmt.Sprintf("order-%d", i)
+		if _, ok := c.GetOrder(uid); ok != (i >= 2) {
+			t.Errorf("GetOrder(%s) found = %v, want %v", uid, ok, i >= 2)
+		}
+	}
+}
+
+func TestPopulateReturnsLoaderError(t *testing.T) {
+	repo := servicetest.NewRepository()
+	repo.FailWith(service.ErrUnavailable)
+
+	c := newCache(t, cache.Limit{Entries: 3})
+	if err := c.Populate(context.Background(), repo); !errors.Is(err, service.ErrUnavailable) {
+		t.Fatalf("Populate error = %v, want ErrUnavailable", err)
+	}
+}
+
+func TestAddGetRemove(t *testing.T) {
+	c := newCache(t, cache.Limit{Entries: 2})
+
+	first := servicetest.NewOrder("order-1")
+	c.AddOrder(first)
+	if got, ok := c.GetOrder("order-1"); !ok || got != first {
+		t.Fatalf("GetOrder = %v, %v", got, ok)
+	}
+
+	replaced := servicetest.NewOrder("order-1")
+	replaced.Delivery.City = "Kazan"
+	c.AddOrder(replaced)
+	if got, _ := c.GetOrder("order-1"); got != replaced {
+		t.Error("AddOrder did not replace cached order")
+	}
+	if c.Len() != 1 {
+		t.Errorf("Len = %d after replace, want 1", c.Len())
+	}
+
+	c.RemoveOrder("order-1")
+	c.RemoveOrder("missing")
+	if _, ok := c.GetOrder("order-1"); ok {
+		t.Error("removed order is still cached")
+	}
+	if stats := c.Stats(); stats.Entries != 0 || stats.Bytes != 0 {
+		t.Errorf("Stats after remove = %+v, want empty", stats)
+	}
+}
+
+func TestStatsTrackBytes(t *testing.T) {
+	c := newCache(t, cache.Limit{Entries: 10, Bytes: 1 << 20})
+
+	c.AddOrder(servicetest.NewOrder("order-1"))
+	one := c.Stats()
+	if one.Entries != 1 || one.Bytes <= 0 || one.MaxEntries != 10 || one.MaxBytes != 1<<20 {
+		t.Fatalf("Stats = %+v", one)
+	}
+
+	big := servicetest.NewOrder("order-2")
+	big.Items = append(big.Items, big.Items[0], big.Items[0], big.Items[0])
+	c.AddOrder(big)
+	two := c.Stats()
+	if two.Entries != 2 || two.Bytes-one.Bytes <= one.Bytes {
+		t.Errorf("order with more items must be estimated larger: %+v then %+v", one, two)
+	}
+}
+
+// Считает, сколько заказов у него запросили
+type countingLoader struct {
+	*servicetest.Repository
+	requested int
+}
+
+func (l *countingLoader) GetRecentOrders(ctx context.Context, limit, offset int) ([]*model.Order, error) {
+	l.requested += limit
+	return l.Repository.GetRecentOrders(ctx, limit, offset)
+}
+
+func TestPopulateStopsAtByteBudget(t *testing.T) {
+	repo := servicetest.NewRepository()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := range 1200 {
+		order := servicetest.NewOrder(fmt.Sprintf("order-%04d", i))
+		order.DateCreated = start.Add(time.Duration(i) * time.Minute)
+		if _, err := repo.SaveOrder(context.Background(), order); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Бюджет на три заказа: Populate не должен читать всю таблицу
+	probe := newCache(t, cache.Limit{Entries: 1})
+	probe.AddOrder(servicetest.NewOrder("order-0000"))
+	budget := 3*probe.Stats().Bytes + 1
+
+	loader := &countingLoader{Repository: repo}
+	c := newCache(t, cache.Limit{Bytes: budget})
+	if err := c.Populate(context.Background(), loader); err != nil {
+		t.Fatalf("Populate: %v", err)
+	}
+
+	if c.Len() != 3 {
+		t.Fatalf("Len = %d, want 3", c.Len())
+	}
+	for _, uid := range []string{"order-1197", "order-1198", "order-1199"} {
+		if _, ok := c.GetOrder(uid); !ok {
+			t.Errorf("recent order %s is not cached", uid)
+		}
+	}
+	if loader.requested > 500 {
+		t.Errorf("requested %d orders for a budget of 3", loader.requested)
+	}
+}
+
+func TestPopulateReadsAllPages(t *testing.T) {
+	repo := servicetest.NewRepository()
+	for i := range 1200 {
+		if _, err := repo.SaveOrder(context.Background(), servicetest.NewOrder(fmt.Sprintf("order-%04d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := newCache(t, cache.Limit{Entries: 1100})
+	if err := c.Populate(context.Background(), repo); err != nil {
+		t.Fatalf("Populate: %v", err)
+	}
+	if c.Len() != 1100 {
+		t.Errorf("Len = %d, want 1100", c.Len())
+	}
+}
+
+func TestAddOrderWithTTL(t *testing.T) {
+	limit := cache.Limit{Entries: 10}
+	policy, err := cache.NewPolicy(cache.PolicyLRU, limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Срока жизни по умолчанию нет, он задан только отдельным заказам
+	c := cache.NewCache(limit, policy, 0)
+
+	c.AddOrder(servicetest.NewOrder("forever"))
+	c.AddOrderWithTTL(servicetest.NewOrder("short"), 10*time.Millisecond)
+	c.AddOrderWithTTL(servicetest.NewOrder("long"), time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.RunJanitor(ctx, 5*time.Millisecond)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for c.Len() != 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	for uid, want := range map[string]bool{"forever": true, "short": false, "long": true} {
+		if _, ok := c.GetOrder(uid); ok != want {
+			t.Errorf("GetOrder(%s) found = %v, want %v", uid, ok, want)
+		}
+	}
+
+	// Заказ без срока жизни заменяет устаревающий
+	c.AddOrderWithTTL(servicetest.NewOrder("long"), 0)
+	if stats := c.Stats(); stats.Entries != 2 {
+		t.Errorf("Stats = %+v, want 2 entries", stats)
+	}
+}
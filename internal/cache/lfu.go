@@ -0,0 +1,127 @@
+package cache
+
+import "container/list"
+
+type lfuEntry struct {
+	key  string
+	size int64
+	freq int
+	elem *list.Element
+}
+
+// Вытесняет ключ, к которому обращались реже всех, а среди них - тот, к которому
+// дольше всех не обращались. Ключи с одинаковой частотой лежат в одном списке,
+// поэтому обращение и вытеснение выполняются за O(1)
+type lfu struct {
+	limit   Limit
+	entries map[string]*lfuEntry
+	bytes   int64
+	// Списки ключей по частоте, в начале списка последний использованный ключ.
+	// Пустые списки удаляются
+	freqs   map[int]*list.List
+	minFreq int
+}
+
+func newLFU(limit Limit) *lfu {
+	return &lfu{
+		limit:   limit,
+		entries: make(map[string]*lfuEntry),
+		freqs:   make(map[int]*list.List),
+	}
+}
+
+func (p *lfu) Access(key string) {
+	entry, ok := p.entries[key]
+	if !ok {
+		return
+	}
+
+	p.unlink(entry)
+	if entry.freq == p.minFreq && p.freqs[entry.freq] == nil {
+		p.minFreq++
+	}
+	entry.freq++
+	p.link(entry)
+}
+
+// Новый ключ, который помещается в ограничение, всегда допускается в кэш: место для него
+// освобождается заранее, иначе он сам как ключ с наименьшей частотой оказался бы
+// первым кандидатом на вытеснение
+func (p *lfu) Add(key string, size int64) []string {
+	// Ключ, который один больше ограничения, вытеснил бы все остальные
+	if p.limit.exceeded(1, size) {
+		p.Remove(key)
+		return []string{key}
+	}
+
+	var evicted []string
+
+	if entry, ok := p.entries[key]; ok {
+		p.bytes += size - entry.size
+		entry.size = size
+		p.Access(key)
+	} else {
+		for len(p.entries) > 0 && p.limit.exceeded(len(p.entries)+1, p.bytes+size) {
+			victim := p.victim()
+			p.Remove(victim.key)
+			evicted = append(evicted, victim.key)
+		}
+
+		entry := &lfuEntry{key: key, size: size, freq: 1}
+		p.entries[key] = entry
+		p.bytes += size
+		p.link(entry)
+		p.minFreq = 1
+	}
+
+	// Превышение остается, если обновленный ключ вырос
+	for p.limit.exceeded(len(p.entries), p.bytes) {
+		victim := p.victim()
+		p.Remove(victim.key)
+		evicted = append(evicted, victim.key)
+	}
+
+	return evicted
+}
+
+func (p *lfu) Remove(key string) {
+	if entry, ok := p.entries[key]; ok {
+		p.unlink(entry)
+		p.bytes -= entry.size
+		delete(p.entries, key)
+	}
+}
+
+// Ключ с наименьшей частотой, к которому дольше всех не обращались. Вызывается, только
+// если ключи есть. После Remove minFreq может указывать на удаленный список,
+// тогда минимальная частота ищется заново
+func (p *lfu) victim() *lfuEntry {
+	keys, ok := p.freqs[p.minFreq]
+	if !ok {
+		p.minFreq = 0
+		for freq := range p.freqs {
+			if p.minFreq == 0 || freq < p.minFreq {
+				p.minFreq = freq
+			}
+		}
+		keys = p.freqs[p.minFreq]
+	}
+	return keys.Back().Value.(*lfuEntry)
+}
+
+func (p *lfu) link(entry *lfuEntry) {
+	keys, ok := p.freqs[entry.freq]
+	if !ok {
+		keys = list.New()
+		p.freqs[entry.freq] = keys
+	}
+	entry.elem = keys.PushFront(entry)
+}
+
+func (p *lfu) unlink(entry *lfuEntry) {
+	keys := p.freqs[entry.freq]
+	keys.Remove(entry.elem)
+	if keys.Len() == 0 {
+		delete(p.freqs, entry.freq)
+	}
+}
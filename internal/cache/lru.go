@@ -0,0 +1,65 @@
+package cache
+
+import "container/list"
+
+type lruEntry struct {
+	key  string
+	size int64
+}
+
+// Вытесняет ключ, к которому дольше всех не обращались
+type lru struct {
+	limit Limit
+	// Элементы списка - *lruEntry, в начале списка последний использованный ключ
+	recency *list.List
+	keys    map[string]*list.Element
+	bytes   int64
+}
+
+func newLRU(limit Limit) *lru {
+	return &lru{
+		limit:   limit,
+		recency: list.New(),
+		keys:    make(map[string]*list.Element),
+	}
+}
+
+func (p *lru) Access(key string) {
+	if elem, ok := p.keys[key]; ok {
+		p.recency.MoveToFront(elem)
+	}
+}
+
+func (p *lru) Add(key string, size int64) []string {
+	// Ключ, который один больше ограничения, вытеснил бы все остальные
+	if p.limit.exceeded(1, size) {
+		p.Remove(key)
+		return []string{key}
+	}
+
+	if elem, ok := p.keys[key]; ok {
+		entry := elem.Value.(*lruEntry)
+		p.bytes += size - entry.size
+		entry.size = size
+		p.recency.MoveToFront(elem)
+	} else {
+		p.keys[key] = p.recency.PushFront(&lruEntry{key: key, size: size})
+		p.bytes += size
+	}
+
+	var evicted []string
+	for p.limit.exceeded(p.recency.Len(), p.bytes) {
+		oldest := p.recency.Back().Value.(*lruEntry)
+		p.Remove(oldest.key)
+		evicted = append(evicted, oldest.key)
+	}
+	return evicted
+}
+
+func (p *lru) Remove(key string) {
+	if elem, ok := p.keys[key]; ok {
+		p.recency.Remove(elem)
+		p.bytes -= elem.Value.(*lruEntry).size
+		delete(p.keys, key)
+	}
+}
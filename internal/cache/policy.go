@@ -0,0 +1,74 @@
+package cache
+
+import "fmt"
+
+// Политики вытеснения
+const (
+	PolicyLRU     = "lru"
+	PolicyLFU     = "lfu"
+	PolicyTinyLFU = "tinylfu"
+)
+
+// Ограничение кэша: число заказов и их суммарный оценочный размер в байтах.
+// 0 означает, что ограничения нет
+type Limit struct {
+	Entries int
+	Bytes   int64
+}
+
+func (l Limit) exceeded(entries int, bytes int64) bool {
+	return l.Entries > 0 && entries > l.Entries || l.Bytes > 0 && bytes > l.Bytes
+}
+
+// Доля ограничения в процентах, но не меньше одного заказа или байта
+func (l Limit) percent(p int) Limit {
+	var part Limit
+	if l.Entries > 0 {
+		part.Entries = max(l.Entries*p/100, 1)
+	}
+	if l.Bytes > 0 {
+		part.Bytes = max(l.Bytes*int64(p)/100, 1)
+	}
+	return part
+}
+
+func (l Limit) minus(other Limit) Limit {
+	var rest Limit
+	if l.Entries > 0 {
+		rest.Entries = max(l.Entries-other.Entries, 0)
+	}
+	if l.Bytes > 0 {
+		rest.Bytes = max(l.Bytes-other.Bytes, 0)
+	}
+	return rest
+}
+
+// Политика вытеснения: решает, какие заказы остаются в кэше. Работает только с ключами
+// и их размерами, сами заказы хранит Cache. Вызовы приходят под блокировкой кэша,
+// поэтому реализации не обязаны быть потокобезопасными
+type Policy interface {
+	// Обращение к ключу при чтении, вызывается и при промахе
+	Access(key string)
+	// Добавляет ключ размером size байт или обновляет размер уже добавленного и возвращает
+	// ключи, которые нужно вытеснить, чтобы кэш уложился в ограничение. Среди них может
+	// оказаться и сам ключ, если политика не допустила его в кэш или он один больше ограничения
+	Add(key string, size int64) (evicted []string)
+	Remove(key string)
+}
+
+// Создает политику по имени из конфига для кэша с ограничением limit
+func NewPolicy(name string, limit Limit) (Policy, error) {
+	if limit.Entries <= 0 && limit.Bytes <= 0 {
+		return nil, fmt.Errorf("cache limit must be set in entries or bytes")
+	}
+
+	switch name {
+	case PolicyLRU:
+		return newLRU(limit), nil
+	case PolicyLFU:
+		return newLFU(limit), nil
+	case PolicyTinyLFU:
+		return newTinyLFU(limit), nil
+	}
+	return nil, fmt.Errorf("unknown cache policy %q", name)
+}
@@ -0,0 +1,83 @@
+package cache_test
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"testing"
+
+	"orders-service/internal/app/model"
+	"orders-service/internal/app/service/servicetest"
+	"orders-service/internal/cache"
+)
+
+// Вытеснение до LRU: при переполнении удаляется первый ключ, который отдаст обход map
+type randomEviction struct {
+	limit int
+	keys  map[string]struct{}
+}
+
+func (p *randomEviction) Access(string) {}
+
+func (p *randomEviction) Add(key string, _ int64) []string {
+	var evicted []string
+	if _, ok := p.keys[key]; !ok && len(p.keys) >= p.limit {
+		for old := range p.keys {
+			delete(p.keys, old)
+			evicted = append(evicted, old)
+			break
+		}
+	}
+	p.keys[key] = struct{}{}
+	return evicted
+}
+
+func (p *randomEviction) Remove(key string) {
+	delete(p.keys, key)
+}
+
+const (
+	benchOrders    = 10000
+	benchCacheSize = 1000
+)
+
+// Читает заказы через кэш, как OrderService.GetOrder: при промахе заказ добавляется в кэш.
+// Ключи выбираются по закону Ципфа, поэтому небольшая часть заказов запрашивается
+// намного чаще остальных. В отчете hit% - доля чтений, которые нашли заказ в кэше
+func benchmarkHitRate(b *testing.B, policy cache.Policy) {
+	orders := make([]*model.Order, benchOrders)
+	for i := range orders {
+		orders[i] = servicetest.NewOrder(fmt.Sprintf("order-%05d", i))
+	}
+
+	c := cache.NewCache(cache.Limit{Entries: benchCacheSize}, policy, 0)
+	zipf := rand.NewZipf(rand.New(rand.NewPCG(1, 2)), 1.1, 1, benchOrders-1)
+
+	hits := 0
+	b.ResetTimer()
+	for range b.N {
+		order := orders[zipf.Uint64()]
+		if _, ok := c.GetOrder(order.OrderUID); ok {
+			hits++
+			continue
+		}
+		c.AddOrder(order)
+	}
+
+	b.ReportMetric(float64(hits)/float64(b.N)*100, "hit%")
+}
+
+func BenchmarkHitRate(b *testing.B) {
+	b.Run("random", func(b *testing.B) {
+		benchmarkHitRate(b, &randomEviction{limit: benchCacheSize, keys: make(map[string]struct{})})
+	})
+
+	for _, name := range []string{cache.PolicyLRU, cache.PolicyLFU, cache.PolicyTinyLFU} {
+		b.Run(name, func(b *testing.B) {
+			policy, err := cache.NewPolicy(name, cache.Limit{Entries: benchCacheSize})
+			if err != nil {
+				b.Fatal(err)
+			}
+			benchmarkHitRate(b, policy)
+		})
+	}
+}
@@ -0,0 +1,316 @@
+package cache
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+var policyNames = []string{PolicyLRU, PolicyLFU, PolicyTinyLFU}
+
+// Политика и ключи, которые по ее ответам остались в кэше, как их видит Cache
+type trackedPolicy struct {
+	t        *testing.T
+	policy   Policy
+	limit    Limit
+	resident map[string]int64
+}
+
+func newTrackedPolicy(t *testing.T, name string, limit Limit) *trackedPolicy {
+	t.Helper()
+
+	policy, err := NewPolicy(name, limit)
+	if err != nil {
+		t.Fatalf("NewPolicy(%s): %v", name, err)
+	}
+	return &trackedPolicy{t: t, policy: policy, limit: limit, resident: make(map[string]int64)}
+}
+
+// Добавляет ключ и проверяет, что вытеснены только ключи из кэша, а кэш уложился в ограничение
+func (p *trackedPolicy) add(key string, size int64) []string {
+	p.t.Helper()
+
+	p.resident[key] = size
+	evicted := p.policy.Add(key, size)
+	for _, k := range evicted {
+		if _, ok := p.resident[k]; !ok {
+			p.t.Fatalf("Add(%s) evicted %s, which is not cached", key, k)
+		}
+		delete(p.resident, k)
+	}
+
+	p.check()
+	return evicted
+}
+
+func (p *trackedPolicy) remove(key string) {
+	p.t.Helper()
+
+	p.policy.Remove(key)
+	delete(p.resident, key)
+	p.check()
+}
+
+func (p *trackedPolicy) access(key string) {
+	p.t.Helper()
+
+	p.policy.Access(key)
+	p.check()
+}
+
+// Кэш читает заказ через Access и при промахе добавляет его
+func (p *trackedPolicy) get(key string, size int64) bool {
+	p.t.Helper()
+
+	p.access(key)
+	if _, ok := p.resident[key]; ok {
+		return true
+	}
+	p.add(key, size)
+	return false
+}
+
+func (p *trackedPolicy) check() {
+	p.t.Helper()
+
+	var bytes int64
+	for _, size := range p.resident {
+		bytes += size
+	}
+	if p.limit.exceeded(len(p.resident), bytes) {
+		p.t.Fatalf("cache holds %d keys, %d bytes over limit %+v", len(p.resident), bytes, p.limit)
+	}
+
+	entries, policyBytes := policyUsage(p.policy)
+	if entries != len(p.resident) || policyBytes != bytes {
+		p.t.Fatalf("policy tracks %d keys, %d bytes, cache holds %d keys, %d bytes", entries, policyBytes, len(p.resident), bytes)
+	}
+}
+
+// Сколько ключей и байт политика считает находящимися в кэше
+func policyUsage(policy Policy) (int, int64) {
+	switch p := policy.(type) {
+	case *lru:
+		return len(p.keys), p.bytes
+	case *lfu:
+		return len(p.entries), p.bytes
+	case *tinyLFU:
+		return len(p.keys), p.bytes[segmentWindow] + p.bytes[segmentProbation] + p.bytes[segmentProtected]
+	}
+	panic(fmt.Sprintf("unknown policy %T", policy))
+}
+
+func TestNewPolicy(t *testing.T) {
+	if _, err := NewPolicy(PolicyLRU, Limit{}); err == nil {
+		t.Error("policy without limit is created")
+	}
+	if _, err := NewPolicy("random", Limit{Entries: 1}); err == nil {
+		t.Error("unknown policy is created")
+	}
+}
+
+func TestPolicyConformance(t *testing.T) {
+	for _, name := range policyNames {
+		t.Run(name, func(t *testing.T) {
+			t.Run("limits", func(t *testing.T) {
+				for _, limit := range []Limit{{Entries: 1}, {Entries: 10}, {Bytes: 1000}, {Entries: 10, Bytes: 500}} {
+					p := newTrackedPolicy(t, name, limit)
+					rnd := rand.New(rand.NewPCG(1, 2))
+					for i := range 500 {
+						key := fmt.Sprintf("k%d", rnd.IntN(50))
+						if i%3 == 0 {
+							p.access(key)
+							continue
+						}
+						p.add(key, 10+rnd.Int64N(90))
+					}
+				}
+			})
+
+			t.Run("oversized key evicts itself", func(t *testing.T) {
+				p := newTrackedPolicy(t, name, Limit{Bytes: 100})
+				p.add("small", 10)
+
+				if evicted := p.add("huge", 101); !slices.Equal(evicted, []string{"huge"}) {
+					t.Errorf("Add of oversized key evicted %v, want only itself", evicted)
+				}
+				if _, ok := p.resident["small"]; !ok {
+					t.Error("oversized key evicted other keys")
+				}
+
+				// Ключ, выросший больше ограничения, тоже уходит из кэша
+				if evicted := p.add("small", 101); !slices.Equal(evicted, []string{"small"}) {
+					t.Errorf("Add of grown key evicted %v, want only itself", evicted)
+				}
+				if evicted := p.add("next", 10); len(evicted) != 0 {
+					t.Errorf("Add after oversized keys evicted %v", evicted)
+				}
+			})
+
+			t.Run("add, remove and access agree", func(t *testing.T) {
+				p := newTrackedPolicy(t, name, Limit{Entries: 8, Bytes: 400})
+				rnd := rand.New(rand.NewPCG(3, 4))
+				for range 2000 {
+					key := fmt.Sprintf("k%d", rnd.IntN(20))
+					switch rnd.IntN(4) {
+					case 0:
+						p.remove(key)
+					case 1:
+						p.access(key)
+					default:
+						p.add(key, 10+rnd.Int64N(90))
+					}
+				}
+
+				// Удаленный ключ политика больше не вытесняет и не учитывает
+				for key := range p.resident {
+					p.remove(key)
+				}
+				p.access("k1")
+				for i := range 4 {
+					if evicted := p.add(fmt.Sprintf("new%d", i), 10); len(evicted) != 0 {
+						t.Fatalf("Add into emptied cache evicted %v", evicted)
+					}
+				}
+			})
+		})
+	}
+}
+
+// Однократный проход по старым заказам не должен вытеснять постоянно читаемые заказы
+func TestTinyLFUResistsScan(t *testing.T) {
+	hot := make([]string, 50)
+	for i := range hot {
+		hot[i] = fmt.Sprintf("hot%d", i)
+	}
+
+	residentHot := make(map[string]int)
+	for _, name := range policyNames {
+		p := newTrackedPolicy(t, name, Limit{Entries: 100})
+		for range 10 {
+			for _, key := range hot {
+				p.get(key, 100)
+			}
+		}
+		for i := range 1000 {
+			p.get(fmt.Sprintf("cold%d", i), 100)
+		}
+
+		for _, key := range hot {
+			if _, ok := p.resident[key]; ok {
+				residentHot[name]++
+			}
+		}
+	}
+
+	if residentHot[PolicyTinyLFU] < 45 {
+		t.Errorf("tinylfu kept %d of %d hot keys after scan", residentHot[PolicyTinyLFU], len(hot))
+	}
+	if residentHot[PolicyLRU] != 0 {
+		t.Errorf("lru kept %d hot keys after a scan larger than the cache", residentHot[PolicyLRU])
+	}
+}
+
+func TestLFUMinFreq(t *testing.T) {
+	p := newTrackedPolicy(t, PolicyLFU, Limit{Entries: 3})
+	lfu := p.policy.(*lfu)
+
+	p.add("a", 1)
+	p.add("b", 1)
+	p.add("c", 1)
+	p.access("a")
+	p.access("a")
+	p.access("b")
+	if lfu.minFreq != 1 {
+		t.Fatalf("minFreq = %d, want 1", lfu.minFreq)
+	}
+
+	if evicted := p.add("d", 1); !slices.Equal(evicted, []string{"c"}) {
+		t.Fatalf("evicted %v, want least frequently used c", evicted)
+	}
+
+	// Обращение к единственному ключу с наименьшей частотой поднимает minFreq
+	p.remove("d")
+	p.add("e", 1)
+	p.access("e")
+	if lfu.minFreq != 2 {
+		t.Fatalf("minFreq = %d after access, want 2", lfu.minFreq)
+	}
+
+	// Среди ключей с одинаковой частотой вытесняется тот, к которому дольше не обращались
+	if evicted := p.add("f", 1); !slices.Equal(evicted, []string{"b"}) {
+		t.Fatalf("evicted %v, want b", evicted)
+	}
+}
+
+func TestLFUFindsMinFreqAfterRemove(t *testing.T) {
+	p := newTrackedPolicy(t, PolicyLFU, Limit{Bytes: 30})
+
+	p.add("a", 10)
+	p.add("b", 10)
+	p.access("a")
+	p.access("b")
+	p.add("c", 10)
+	// minFreq остается 1, хотя ключей с такой частотой больше нет
+	p.remove("c")
+
+	if evicted := p.add("a", 25); !slices.Equal(evicted, []string{"b"}) {
+		t.Fatalf("evicted %v after growing a, want b", evicted)
+	}
+}
+
+func TestTinyLFUSegments(t *testing.T) {
+	// Окно - 1 ключ, основная часть - 9, из них protected - 7
+	p := newTrackedPolicy(t, PolicyTinyLFU, Limit{Entries: 10})
+	tiny := p.policy.(*tinyLFU)
+	// Широкий sketch, чтобы коллизии хэшей не искажали частоты в проверках допуска
+	tiny.sketch = newCountMinSketch(1 << 16)
+	segment := func(key string) int {
+		t.Helper()
+		elem, ok := tiny.keys[key]
+		if !ok {
+			t.Fatalf("key %s is not cached", key)
+		}
+		return elem.Value.(*tinyLFUEntry).segment
+	}
+
+	for i := range 10 {
+		p.add(fmt.Sprintf("k%d", i), 1)
+	}
+	if segment("k9") != segmentWindow || segment("k0") != segmentProbation {
+		t.Fatalf("new key must be in window and older ones in probation: k9 %d, k0 %d", segment("k9"), segment("k0"))
+	}
+
+	// Повторное обращение переводит ключ в protected, а переполнение protected
+	// возвращает самый старый ключ в probation
+	for i := range 8 {
+		p.access(fmt.Sprintf("k%d", i))
+	}
+	if segment("k0") != segmentProbation {
+		t.Errorf("k0 segment = %d, want demoted to probation", segment("k0"))
+	}
+	for i := 1; i < 8; i++ {
+		if segment(fmt.Sprintf("k%d", i)) != segmentProtected {
+			t.Errorf("k%d segment = %d, want protected", i, segment(fmt.Sprintf("k%d", i)))
+		}
+	}
+
+	// Редкий кандидат из окна не вытесняет ключи основной части
+	if evicted := p.add("cold", 1); !slices.Equal(evicted, []string{"k9"}) {
+		t.Fatalf("evicted %v, want rejected candidate k9", evicted)
+	}
+
+	// Частый кандидат вытесняет самый старый ключ probation
+	for range 5 {
+		p.access("hot")
+	}
+	p.add("hot", 1)
+	evicted := p.add("next", 1)
+	if len(evicted) != 1 || evicted[0] == "hot" {
+		t.Fatalf("evicted %v, want one key of the main part", evicted)
+	}
+	if segment("hot") != segmentProbation {
+		t.Errorf("admitted key segment = %d, want probation", segment("hot"))
+	}
+}
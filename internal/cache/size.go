@@ -0,0 +1,46 @@
+package cache
+
+import (
+	"unsafe"
+
+	"orders-service/internal/app/model"
+)
+
+// Накладные расходы на заказ в кэше помимо самого заказа: запись в map, элемент
+// списка политики, ключ и время жизни. Точный размер зависит от рантайма, для бюджета
+// памяти достаточно порядка величины
+const entryOverhead = 256
+
+// Оценочный размер заказа в памяти в байтах: структуры заказа и товаров и содержимое
+// их строк. Считается один раз при добавлении в кэш
+func estimateSize(order *model.Order) int64 {
+	size := int64(unsafe.Sizeof(*order)) + entryOverhead
+
+	size += int64(len(order.OrderUID) + len(order.TrackNumber) + len(order.Entry) +
+		len(order.Locale) + len(order.InternalSignature) + len(order.CustomerID) +
+		len(order.DeliveryService) + len(order.Shardkey) + len(order.OofShard) +
+		len(order.Status) + len(order.CancelReason))
+	if order.CancelledAt != nil {
+		size += int64(unsafe.Sizeof(*order.CancelledAt))
+	}
+	if order.UpdatedAt != nil {
+		size += int64(unsafe.Sizeof(*order.UpdatedAt))
+	}
+
+	d := &order.Delivery
+	size += int64(len(d.OrderUID) + len(d.Name) + len(d.Phone) + len(d.Zip) +
+		len(d.City) + len(d.Address) + len(d.Region) + len(d.Email))
+
+	p := &order.Payment
+	size += int64(len(p.OrderUID) + len(p.Transaction) + len(p.RequestID) +
+		len(p.Currency) + len(p.Provider) + len(p.Bank))
+
+	size += int64(cap(order.Items)) * int64(unsafe.Sizeof(model.Item{}))
+	for i := range order.Items {
+		item := &order.Items[i]
+		size += int64(len(item.OrderUID) + len(item.TrackNumber) + len(item.Rid) +
+			len(item.Name) + len(item.Size) + len(item.Brand))
+	}
+
+	return size
+}
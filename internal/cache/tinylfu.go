@@ -0,0 +1,257 @@
+package cache
+
+import (
+	"container/list"
+	"hash/maphash"
+)
+
+// Сегменты W-TinyLFU
+const (
+	segmentWindow = iota
+	segmentProbation
+	segmentProtected
+)
+
+type tinyLFUEntry struct {
+	key     string
+	size    int64
+	segment int
+}
+
+// W-TinyLFU: новые ключи попадают в небольшое LRU окно, а вытесненный из окна ключ
+// попадает в основную часть кэша, только если к нему обращались чаще, чем к ключам,
+// которые пришлось бы ради него вытеснить. Частоты приблизительно считает count-min sketch,
+// в том числе для ключей, которых в кэше нет. Поэтому однократный проход по старым заказам
+// проходит через окно и не вытесняет часто запрашиваемые заказы.
+// Основная часть - сегментированный LRU: ключ, к которому обратились повторно,
+// переходит из probation в protected
+type tinyLFU struct {
+	// Кэш на один заказ не делится на окно и основную часть: новые ключи сразу претендуют на место
+	noWindow       bool
+	windowLimit    Limit
+	mainLimit      Limit
+	protectedLimit Limit
+
+	// Списки сегментов, в начале списка последний использованный ключ, и их размеры в байтах
+	segments [3]*list.List
+	bytes    [3]int64
+	keys     map[string]*list.Element
+
+	sketch *countMinSketch
+}
+
+func newTinyLFU(limit Limit) *tinyLFU {
+	// Окно - 1% кэша, protected - 80% основной части, как в Caffeine
+	windowLimit := limit.percent(1)
+	mainLimit := limit.minus(windowLimit)
+	noWindow := limit.Entries == 1 || limit.Bytes == 1
+	if noWindow {
+		mainLimit = limit
+	}
+
+	// Размер sketch зависит от числа заказов. При ограничении только в байтах
+	// число заказов оценивается по среднему заказу в несколько килобайт
+	entries := limit.Entries
+	if entries <= 0 {
+		entries = int(limit.Bytes / 4096)
+	}
+
+	return &tinyLFU{
+		noWindow:       noWindow,
+		windowLimit:    windowLimit,
+		mainLimit:      mainLimit,
+		protectedLimit: mainLimit.percent(80),
+		segments:       [3]*list.List{list.New(), list.New(), list.New()},
+		keys:           make(map[string]*list.Element),
+		sketch:         newCountMinSketch(entries),
+	}
+}
+
+func (p *tinyLFU) Access(key string) {
+	p.sketch.increment(key)
+
+	elem, ok := p.keys[key]
+	if !ok {
+		return
+	}
+
+	entry := elem.Value.(*tinyLFUEntry)
+	if entry.segment != segmentProbation {
+		p.segments[entry.segment].MoveToFront(elem)
+		return
+	}
+
+	// Повторное обращение переводит ключ в protected, а вытесненные из protected
+	// ключи возвращаются в probation и получают еще один шанс
+	p.unlink(elem)
+	p.push(entry, segmentProtected)
+	for p.segments[segmentProtected].Len() > 1 &&
+		p.protectedLimit.exceeded(p.segments[segmentProtected].Len(), p.bytes[segmentProtected]) {
+		demoted := p.segments[segmentProtected].Back()
+		p.unlink(demoted)
+		p.push(demoted.Value.(*tinyLFUEntry), segmentProbation)
+	}
+}
+
+func (p *tinyLFU) Add(key string, size int64) []string {
+	// Ключ, который не помещается в основную часть, в кэш не допускается
+	if p.mainLimit.exceeded(1, size) {
+		p.Remove(key)
+		return []string{key}
+	}
+
+	if elem, ok := p.keys[key]; ok {
+		entry := elem.Value.(*tinyLFUEntry)
+		p.bytes[entry.segment] += size - entry.size
+		entry.size = size
+		p.Access(key)
+	} else if p.noWindow {
+		p.sketch.increment(key)
+		return p.admit(&tinyLFUEntry{key: key, size: size})
+	} else {
+		p.sketch.increment(key)
+		p.push(&tinyLFUEntry{key: key, size: size}, segmentWindow)
+	}
+
+	var evicted []string
+
+	// Ключи, вытесненные из окна, претендуют на место в основной части
+	for p.windowLimit.exceeded(p.segments[segmentWindow].Len(), p.bytes[segmentWindow]) {
+		oldest := p.segments[segmentWindow].Back()
+		p.unlink(oldest)
+		evicted = append(evicted, p.admit(oldest.Value.(*tinyLFUEntry))...)
+	}
+
+	// Основная часть может оказаться переполнена, если в ней вырос обновленный ключ
+	for p.mainExceeded(0, 0) {
+		victim := p.mainVictim()
+		p.unlink(victim)
+		evicted = append(evicted, victim.Value.(*tinyLFUEntry).key)
+	}
+
+	return evicted
+}
+
+// Решает, пустить ли кандидата из окна в основную часть. Пока кандидату не хватает места,
+// он сравнивается с очередной жертвой - ключом, к которому дольше всех не обращались,
+// и вытесняет ее, только если его запрашивали чаще. Возвращает вытесненные ключи
+func (p *tinyLFU) admit(candidate *tinyLFUEntry) []string {
+	var evicted []string
+	for p.mainExceeded(1, candidate.size) {
+		victim := p.mainVictim()
+		if p.sketch.estimate(candidate.key) <= p.sketch.estimate(victim.Value.(*tinyLFUEntry).key) {
+			return append(evicted, candidate.key)
+		}
+		p.unlink(victim)
+		evicted = append(evicted, victim.Value.(*tinyLFUEntry).key)
+	}
+
+	p.push(candidate, segmentProbation)
+	return evicted
+}
+
+// Превышено ли ограничение основной части, если добавить в нее entries ключей размером bytes
+func (p *tinyLFU) mainExceeded(entries int, bytes int64) bool {
+	return p.mainLimit.exceeded(
+		p.segments[segmentProbation].Len()+p.segments[segmentProtected].Len()+entries,
+		p.bytes[segmentProbation]+p.bytes[segmentProtected]+bytes,
+	)
+}
+
+// Ключ основной части, к которому дольше всех не обращались: сначала из probation.
+// Вызывается, только если основная часть не пуста
+func (p *tinyLFU) mainVictim() *list.Element {
+	if victim := p.segments[segmentProbation].Back(); victim != nil {
+		return victim
+	}
+	return p.segments[segmentProtected].Back()
+}
+
+func (p *tinyLFU) Remove(key string) {
+	if elem, ok := p.keys[key]; ok {
+		p.unlink(elem)
+	}
+}
+
+func (p *tinyLFU) push(entry *tinyLFUEntry, segment int) {
+	entry.segment = segment
+	p.keys[entry.key] = p.segments[segment].PushFront(entry)
+	p.bytes[segment] += entry.size
+}
+
+func (p *tinyLFU) unlink(elem *list.Element) {
+	entry := elem.Value.(*tinyLFUEntry)
+	p.segments[entry.segment].Remove(elem)
+	p.bytes[entry.segment] -= entry.size
+	delete(p.keys, entry.key)
+}
+
+const (
+	sketchDepth      = 4
+	sketchMaxCounter = 15
+)
+
+// Приблизительный счетчик частот обращений: четыре строки счетчиков, частота ключа -
+// минимум из его счетчиков. Когда число обращений достигает resetAt, все счетчики
+// делятся пополам, чтобы старая популярность со временем забывалась
+type countMinSketch struct {
+	rows    [sketchDepth][]uint8
+	mask    uint64
+	seed    maphash.Seed
+	added   int
+	resetAt int
+}
+
+func newCountMinSketch(capacity int) *countMinSketch {
+	width := 16
+	for width < capacity {
+		width <<= 1
+	}
+
+	s := &countMinSketch{
+		mask:    uint64(width - 1),
+		seed:    maphash.MakeSeed(),
+		resetAt: 10 * max(capacity, 1),
+	}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+	return s
+}
+
+// Индексы счетчиков ключа по двойному хэшированию
+func (s *countMinSketch) indexes(key string) [sketchDepth]uint64 {
+	hash := maphash.String(s.seed, key)
+	h1, h2 := hash, hash>>32|1
+	var idx [sketchDepth]uint64
+	for i := range idx {
+		idx[i] = (h1 + uint64(i)*h2) & s.mask
+	}
+	return idx
+}
+
+func (s *countMinSketch) increment(key string) {
+	for i, j := range s.indexes(key) {
+		if s.rows[i][j] < sketchMaxCounter {
+			s.rows[i][j]++
+		}
+	}
+
+	s.added++
+	if s.added >= s.resetAt {
+		for i := range s.rows {
+			for j := range s.rows[i] {
+				s.rows[i][j] >>= 1
+			}
+		}
+		s.added /= 2
+	}
+}
+
+func (s *countMinSketch) estimate(key string) uint8 {
+	minCount := uint8(sketchMaxCounter)
+	for i, j := range s.indexes(key) {
+		minCount = min(minCount, s.rows[i][j])
+	}
+	return minCount
+}
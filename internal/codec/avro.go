@@ -0,0 +1,104 @@
+package codec
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+
+	"orders-service/internal/app/model"
+
+	"github.com/hamba/avro/v2"
+)
+
+//go:embed schemas/*.avsc
+var embeddedAvroSchemas embed.FS
+
+// Файл схемы Avro: order.v<версия>.avsc
+var avroSchemaFile = regexp.MustCompile(`^order\.v([0-9]+)\.avsc$`)
+
+// Поля схем совпадают с JSON именами полей модели, поэтому заказ декодируется
+// сразу в model.Order без отдельных структур
+var avroAPI = avro.Config{TagKey: "json"}.Freeze()
+
+// Замена реестра схем: схема, которой записано сообщение, выбирается по версии из заголовка
+type avroSchemas struct {
+	byVersion map[int]avro.Schema
+}
+
+func loadAvroSchemas(dir string) (*avroSchemas, error) {
+	s := &avroSchemas{byVersion: make(map[int]avro.Schema)}
+
+	if err := s.load(embeddedAvroSchemas, "schemas"); err != nil {
+		return nil, err
+	}
+	if dir != "" {
+		if err := s.load(os.DirFS(dir), "."); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+func (s *avroSchemas) load(fsys fs.FS, dir string) error {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return fmt.Errorf("failed to read avro schemas: %w", err)
+	}
+
+	for _, entry := range entries {
+		match := avroSchemaFile.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+		version, err := strconv.Atoi(match[1])
+		if err != nil || version <= 0 {
+			return fmt.Errorf("invalid avro schema version in %s", entry.Name())
+		}
+
+		data, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return fmt.Errorf("failed to read avro schema %s: %w", entry.Name(), err)
+		}
+		schema, err := avro.Parse(string(data))
+		if err != nil {
+			return fmt.Errorf("failed to parse avro schema %s: %w", entry.Name(), err)
+		}
+		s.byVersion[version] = schema
+	}
+
+	return nil
+}
+
+func (s *avroSchemas) versions() []int {
+	versions := make([]int, 0, len(s.byVersion))
+	for v := range s.byVersion {
+		versions = append(versions, v)
+	}
+	slices.Sort(versions)
+	return versions
+}
+
+// В отличие от JSON и Protobuf, Avro нельзя разобрать без схемы, которой сообщение записано,
+// поэтому версия схемы обязательна
+func (s *avroSchemas) decode(version int, data []byte) (*model.Order, error) {
+	if version == 0 {
+		return nil, fmt.Errorf("%w: %s message without %s header", ErrUnsupportedFormat, ContentTypeAvro, HeaderSchemaVersion)
+	}
+	schema, ok := s.byVersion[version]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s schema version %d", ErrUnsupportedFormat, ContentTypeAvro, version)
+	}
+
+	order := &model.Order{}
+	if err := avroAPI.Unmarshal(schema, data, order); err != nil {
+		return nil, fmt.Errorf("%w: failed to decode avro order: %w", ErrMalformed, err)
+	}
+	order.DateCreated = order.DateCreated.UTC()
+	return order, nil
+}
@@ -0,0 +1,176 @@
+package codec
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"strconv"
+	"strings"
+
+	"orders-service/internal/app/model"
+	"orders-service/internal/source"
+)
+
+// Заголовки сообщения, по которым выбирается декодер
+const (
+	HeaderContentType   = "content-type"
+	HeaderSchemaVersion = "schema-version"
+)
+
+// Поддерживаемые форматы тела сообщения
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/x-protobuf"
+	ContentTypeAvro     = "application/avro"
+)
+
+// Сообщения без заголовков отправляют старые продюсеры, их формат - JSON первой версии
+const legacyJSONVersion = 1
+
+// Другие названия форматов, которые встречаются у продюсеров
+var contentTypeAliases = map[string]string{
+	ContentTypeJSON:                      ContentTypeJSON,
+	"text/json":                          ContentTypeJSON,
+	ContentTypeProtobuf:                  ContentTypeProtobuf,
+	"application/protobuf":               ContentTypeProtobuf,
+	"application/vnd.google.protobuf":    ContentTypeProtobuf,
+	ContentTypeAvro:                      ContentTypeAvro,
+	"avro/binary":                        ContentTypeAvro,
+	"application/vnd.apache.avro+binary": ContentTypeAvro,
+}
+
+var (
+	// Формат или версия схемы сообщения не поддерживаются
+	ErrUnsupportedFormat = errors.New("unsupported message format")
+	// Тело сообщения не соответствует заявленному формату
+	ErrMalformed = errors.New("malformed message")
+)
+
+// Формат тела сообщения. SchemaVersion 0 означает, что версия не указана
+type Format struct {
+	ContentType   string
+	SchemaVersion int
+}
+
+func (f Format) String() string {
+	if f.SchemaVersion == 0 {
+		return f.ContentType
+	}
+	return fmt.Sprintf("%s v%d", f.ContentType, f.SchemaVersion)
+}
+
+// Разбирает значения заголовков content-type и schema-version. Пустой content-type означает JSON,
+// версия может быть передана и параметром content-type, например application/avro; version=2
+func ParseFormat(contentType, schemaVersion string) (Format, error) {
+	if contentType == "" {
+		contentType = ContentTypeJSON
+	}
+
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return Format{}, fmt.Errorf("%w: invalid content type %q: %w", ErrUnsupportedFormat, contentType, err)
+	}
+	canonical, ok := contentTypeAliases[mediaType]
+	if !ok {
+		return Format{}, fmt.Errorf("%w: content type %q", ErrUnsupportedFormat, mediaType)
+	}
+
+	if schemaVersion == "" {
+		schemaVersion = params["version"]
+	}
+	version := 0
+	if schemaVersion != "" {
+		version, err = strconv.Atoi(strings.TrimPrefix(schemaVersion, "v"))
+		if err != nil || version <= 0 {
+			return Format{}, fmt.Errorf("%w: invalid schema version %q", ErrUnsupportedFormat, schemaVersion)
+		}
+	}
+
+	if canonical == ContentTypeJSON && version == 0 {
+		version = legacyJSONVersion
+	}
+
+	return Format{ContentType: canonical, SchemaVersion: version}, nil
+}
+
+// Определяет формат сообщения по его заголовкам. Имена заголовков не зависят от регистра
+func FormatOf(headers []source.Header) (Format, error) {
+	var contentType, schemaVersion string
+	for _, h := range headers {
+		switch strings.ToLower(h.Key) {
+		case HeaderContentType:
+			contentType = string(h.Value)
+		case HeaderSchemaVersion:
+			schemaVersion = string(h.Value)
+		}
+	}
+
+	return ParseFormat(contentType, schemaVersion)
+}
+
+// Декодирует тело сообщения в событие заказа. Protobuf и Avro сообщения содержат
+// заказ целиком и считаются событием order.created. Сообщения топиков, для которых
+// задан перевод (MapTopic), переводятся из формата маркетплейса
+type Registry struct {
+	avro   *avroSchemas
+	topics map[string]*Mapping
+}
+
+// Создает реестр декодеров. Схемы Avro встроены в сервис, из avroSchemaDir (если задан)
+// дополнительно читаются файлы order.v<N>.avsc, которые добавляют или заменяют версии
+func NewRegistry(avroSchemaDir string) (*Registry, error) {
+	schemas, err := loadAvroSchemas(avroSchemaDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Registry{avro: schemas, topics: make(map[string]*Mapping)}, nil
+}
+
+// Задает перевод для сообщений топика. Вызывается до начала чтения
+func (r *Registry) MapTopic(topic string, mapping *Mapping) {
+	r.topics[topic] = mapping
+}
+
+// Версии схем Avro, известные реестру
+func (r *Registry) AvroVersions() []int {
+	return r.avro.versions()
+}
+
+func (r *Registry) Decode(format Format, data []byte) (*model.OrderEvent, error) {
+	switch format.ContentType {
+	case ContentTypeJSON:
+		return decodeJSON(format.SchemaVersion, data)
+	case ContentTypeProtobuf:
+		return orderCreated(decodeProtobuf(format.SchemaVersion, data))
+	case ContentTypeAvro:
+		return orderCreated(r.avro.decode(format.SchemaVersion, data))
+	}
+	return nil, fmt.Errorf("%w: content type %q", ErrUnsupportedFormat, format.ContentType)
+}
+
+// Декодирует тело сообщения из топика: переводом топика, если он задан, иначе по формату
+func (r *Registry) DecodeTopic(topic string, format Format, data []byte) (*model.OrderEvent, error) {
+	if mapping, ok := r.topics[topic]; ok {
+		return mapping.Decode(format, data)
+	}
+	return r.Decode(format, data)
+}
+
+// Определяет формат по заголовкам сообщения и декодирует его тело
+func (r *Registry) DecodeMessage(m source.Message) (*model.OrderEvent, Format, error) {
+	format, err := FormatOf(m.Headers)
+	if err != nil {
+		return nil, format, err
+	}
+
+	event, err := r.DecodeTopic(m.Topic, format, m.Value)
+	return event, format, err
+}
+
+func orderCreated(order *model.Order, err error) (*model.OrderEvent, error) {
+	if err != nil {
+		return nil, err
+	}
+	return &model.OrderEvent{Type: model.EventOrderCreated, OrderUID: order.OrderUID, Order: order}, nil
+}
@@ -0,0 +1,311 @@
+package codec_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"orders-service/internal/app/model"
+	"orders-service/internal/codec"
+
+	"github.com/hamba/avro/v2"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	_ "google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// После намеренного изменения схемы фикстуры перезаписываются:
+// go test ./internal/codec -run TestRoundTrip -update
+var update = flag.Bool("update", false, "rewrite testdata fixtures")
+
+// Заказ, в котором заполнены все поля схем, в том числе отрицательные и 64-битные числа
+func fixtureOrder() *model.Order {
+	return &model.Order{
+		OrderUID:    "b563feb7b2b84b6test",
+		TrackNumber: "WBILMTESTTRACK",
+		Entry:       "WBIL",
+		Delivery: model.Delivery{
+			Name:    "Test Testov",
+			Phone:   "+9720000000",
+			Zip:     "2639809",
+			City:    "Kiryat Mozkin",
+			Address: "Ploshad Mira 15",
+			Region:  "Kraiot",
+			Email:   "test@gmail.com",
+		},
+		Payment: model.Payment{
+			Transaction:  "b563feb7b2b84b6test",
+			RequestID:    "req-1",
+			Currency:     "USD",
+			Provider:     "wbpay",
+			Amount:       1817,
+			PaymentDt:    1637907727000,
+			Bank:         "alpha",
+			DeliveryCost: 1500,
+			GoodsTotal:   317,
+			CustomFee:    -5,
+		},
+		Items: []model.Item{
+			{ChrtID: 9934930, TrackNumber: "WBILMTESTTRACK", Price: 453, Rid: "ab4219087a764ae0btest", Name: "Mascaras", Sale: 30, Size: "0", TotalPrice: 317, NmID: 2389212, Brand: "Vivienne Sabo", Status: 202},
+			{ChrtID: 1, TrackNumber: "WBILMTESTTRACK", Price: 0, Rid: "ab4219087a764ae0btest2", Name: "Гель для душа", Size: "M", NmID: 1 << 40, Brand: "Чистая линия", Status: 200},
+		},
+		Locale:            "en",
+		InternalSignature: "sig",
+		CustomerID:        "test",
+		DeliveryService:   "meest",
+		Shardkey:          "9",
+		SmID:              99,
+		// Avro хранит время с точностью до миллисекунд
+		DateCreated: time.Date(2021, 11, 26, 6, 22, 19, 123_000_000, time.UTC),
+		OofShard:    "1",
+	}
+}
+
+type encoder func(t *testing.T, order *model.Order) []byte
+
+// Фикстуры по форматам и версиям схем. Кодировщики независимы от декодеров сервиса:
+// JSON - encoding/json, Protobuf - библиотека protobuf по схеме из schemas/order.v1.proto,
+// Avro - по схеме из schemas/order.v1.avsc
+var fixtures = []struct {
+	file   string
+	format codec.Format
+	encode encoder
+}{
+	{"order.v1.json", codec.Format{ContentType: codec.ContentTypeJSON, SchemaVersion: 1}, encodeJSON},
+	{"order.v1.pb", codec.Format{ContentType: codec.ContentTypeProtobuf, SchemaVersion: 1}, encodeProtobufV1},
+	{"order.v1.avro", codec.Format{ContentType: codec.ContentTypeAvro, SchemaVersion: 1}, encodeAvroV1},
+}
+
+func TestRoundTrip(t *testing.T) {
+	registry, err := codec.NewRegistry("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := fixtureOrder()
+
+	for _, f := range fixtures {
+		t.Run(f.format.String(), func(t *testing.T) {
+			encoded := f.encode(t, want)
+			path := filepath.Join("testdata", f.file)
+			if *update {
+				if err := os.WriteFile(path, encoded, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			fixture, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Фикстура фиксирует формат, который шлют продюсеры: изменение схемы,
+			// меняющее кодирование, должно быть заметно в диффе testdata
+			if !bytes.Equal(encoded, fixture) {
+				t.Errorf("encoded order differs from %s, rerun with -update if the schema was changed on purpose", path)
+			}
+
+			for name, data := range map[string][]byte{"fixture": fixture, "encoded": encoded} {
+				event, err := registry.Decode(f.format, data)
+				if err != nil {
+					t.Fatalf("decode %s: %v", name, err)
+				}
+				if event.Type != model.EventOrderCreated || event.OrderUID != want.OrderUID {
+					t.Errorf("decode %s: event %s for %q, want order.created for %q", name, event.Type, event.OrderUID, want.OrderUID)
+				}
+				if !reflect.DeepEqual(event.Order, want) {
+					t.Errorf("decode %s:\n got %+v\nwant %+v", name, event.Order, want)
+				}
+			}
+		})
+	}
+}
+
+func TestProtobufCompatibility(t *testing.T) {
+	registry, err := codec.NewRegistry("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := encodeProtobufV1(t, fixtureOrder())
+
+	// Без версии в заголовках сообщение разбирается по первой версии схемы
+	if event, err := registry.Decode(codec.Format{ContentType: codec.ContentTypeProtobuf}, data); err != nil || !reflect.DeepEqual(event.Order, fixtureOrder()) {
+		t.Errorf("decode without version = %+v, %v", event, err)
+	}
+
+	// Поля, добавленные в схему позже, старый консьюмер пропускает
+	extended := protowire.AppendTag(bytes.Clone(data), 100, protowire.BytesType)
+	extended = protowire.AppendString(extended, "new field")
+	extended = protowire.AppendTag(extended, 101, protowire.Fixed64Type)
+	extended = protowire.AppendFixed64(extended, 42)
+	if event, err := registry.Decode(codec.Format{ContentType: codec.ContentTypeProtobuf, SchemaVersion: 1}, extended); err != nil || !reflect.DeepEqual(event.Order, fixtureOrder()) {
+		t.Errorf("decode with unknown fields = %+v, %v", event, err)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	registry, err := codec.NewRegistry("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	order := fixtureOrder()
+	pb := encodeProtobufV1(t, order)
+	av := encodeAvroV1(t, order)
+
+	for _, tc := range []struct {
+		name   string
+		format codec.Format
+		data   []byte
+		want   error
+	}{
+		{"json v2", codec.Format{ContentType: codec.ContentTypeJSON, SchemaVersion: 2}, encodeJSON(t, order), codec.ErrUnsupportedFormat},
+		{"protobuf v2", codec.Format{ContentType: codec.ContentTypeProtobuf, SchemaVersion: 2}, pb, codec.ErrUnsupportedFormat},
+		{"avro without version", codec.Format{ContentType: codec.ContentTypeAvro}, av, codec.ErrUnsupportedFormat},
+		{"avro v2", codec.Format{ContentType: codec.ContentTypeAvro, SchemaVersion: 2}, av, codec.ErrUnsupportedFormat},
+		{"truncated json", codec.Format{ContentType: codec.ContentTypeJSON, SchemaVersion: 1}, []byte(`{"order_uid": "x"`), codec.ErrMalformed},
+		{"truncated protobuf", codec.Format{ContentType: codec.ContentTypeProtobuf, SchemaVersion: 1}, pb[:len(pb)-1], codec.ErrMalformed},
+		{"truncated avro", codec.Format{ContentType: codec.ContentTypeAvro, SchemaVersion: 1}, av[:len(av)/2], codec.ErrMalformed},
+		{"protobuf string as number", codec.Format{ContentType: codec.ContentTypeProtobuf, SchemaVersion: 1}, protowire.AppendVarint(protowire.AppendTag(nil, 1, protowire.VarintType), 1), codec.ErrMalformed},
+	} {
+		if _, err := registry.Decode(tc.format, tc.data); !errors.Is(err, tc.want) {
+			t.Errorf("%s: error = %v, want %v", tc.name, err, tc.want)
+		}
+	}
+}
+
+func encodeJSON(t *testing.T, order *model.Order) []byte {
+	t.Helper()
+
+	data, err := json.MarshalIndent(order, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(data, '\n')
+}
+
+func encodeAvroV1(t *testing.T, order *model.Order) []byte {
+	t.Helper()
+
+	text, err := os.ReadFile(filepath.Join("schemas", "order.v1.avsc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema, err := avro.Parse(string(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := avro.Config{TagKey: "json"}.Freeze().Marshal(schema, order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// Кодирует заказ библиотекой protobuf: заказ переводится в protojson, а из него в сообщение,
+// описанное schemas/order.v1.proto. Имена полей схемы совпадают с JSON именами полей модели
+func encodeProtobufV1(t *testing.T, order *model.Order) []byte {
+	t.Helper()
+
+	desc := loadProtoOrder(t, filepath.Join("schemas", "order.v1.proto"))
+	msg := dynamicpb.NewMessage(desc)
+
+	data, err := json.Marshal(order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(data, msg); err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return encoded
+}
+
+var (
+	protoMessageLine = regexp.MustCompile(`^message (\w+) \{$`)
+	protoFieldLine   = regexp.MustCompile(`^(repeated )?([\w.]+) (\w+) = (\d+);$`)
+)
+
+// Собирает дескриптор сообщения Order из .proto файла. Схема сервиса использует только
+// строки, int64, вложенные сообщения и google.protobuf.Timestamp, поэтому полноценный
+// парсер .proto не нужен
+func loadProtoOrder(t *testing.T, path string) protoreflect.MessageDescriptor {
+	t.Helper()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	file := &descriptorpb.FileDescriptorProto{
+		Name:       proto.String(filepath.Base(path)),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"google/protobuf/timestamp.proto"},
+	}
+	var message *descriptorpb.DescriptorProto
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "package "):
+			file.Package = proto.String(strings.TrimSuffix(strings.TrimPrefix(line, "package "), ";"))
+		case protoMessageLine.MatchString(line):
+			message = &descriptorpb.DescriptorProto{Name: proto.String(protoMessageLine.FindStringSubmatch(line)[1])}
+			file.MessageType = append(file.MessageType, message)
+		case protoFieldLine.MatchString(line):
+			m := protoFieldLine.FindStringSubmatch(line)
+			num, _ := strconv.Atoi(m[4])
+			field := &descriptorpb.FieldDescriptorProto{
+				Name:   proto.String(m[3]),
+				Number: proto.Int32(int32(num)),
+				Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			}
+			if m[1] != "" {
+				field.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+			}
+			switch m[2] {
+			case "string":
+				field.Type = descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum()
+			case "int64":
+				field.Type = descriptorpb.FieldDescriptorProto_TYPE_INT64.Enum()
+			case "google.protobuf.Timestamp":
+				field.Type = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum()
+				field.TypeName = proto.String(".google.protobuf.Timestamp")
+			default:
+				field.Type = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum()
+				field.TypeName = proto.String("." + file.GetPackage() + "." + m[2])
+			}
+			message.Field = append(message.Field, field)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	fd, err := protodesc.NewFile(file, protoregistry.GlobalFiles)
+	if err != nil {
+		t.Fatalf("invalid schema %s: %v", path, err)
+	}
+	desc := fd.Messages().ByName("Order")
+	if desc == nil {
+		t.Fatalf("schema %s has no Order message", path)
+	}
+	return desc
+}
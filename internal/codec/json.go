@@ -0,0 +1,41 @@
+package codec
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"orders-service/internal/app/model"
+)
+
+// Разбирает JSON сообщение первой версии. Сообщение без поля type - это заказ в исходном формате,
+// он считается событием order.created
+func decodeJSON(version int, data []byte) (*model.OrderEvent, error) {
+	if version != 1 {
+		return nil, fmt.Errorf("%w: %s schema version %d", ErrUnsupportedFormat, ContentTypeJSON, version)
+	}
+
+	var probe struct {
+		Type model.EventType `json:"type"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, fmt.Errorf("%w: failed to unmarshal event: %w", ErrMalformed, err)
+	}
+
+	if probe.Type == "" {
+		var order model.Order
+		if err := json.Unmarshal(data, &order); err != nil {
+			return nil, fmt.Errorf("%w: failed to unmarshal order: %w", ErrMalformed, err)
+		}
+		return &model.OrderEvent{Type: model.EventOrderCreated, OrderUID: order.OrderUID, Order: &order}, nil
+	}
+
+	var event model.OrderEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		return nil, fmt.Errorf("%w: failed to unmarshal event: %w", ErrMalformed, err)
+	}
+	if event.OrderUID == "" && event.Order != nil {
+		event.OrderUID = event.Order.OrderUID
+	}
+
+	return &event, nil
+}
@@ -0,0 +1,181 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+
+	"orders-service/internal/app/model"
+)
+
+// Перевод заказа маркетплейса в model.Order. Поля задаются JSON pointer'ами (RFC 6901):
+// ключ - поле заказа, значение - поле исходного сообщения. Поля, которых нет в
+// исходном сообщении, берутся из Defaults или остаются пустыми
+type Mapping struct {
+	Fields   map[string]string      `json:"fields"`
+	Lists    map[string]ListMapping `json:"lists"`
+	Defaults map[string]any         `json:"defaults"`
+}
+
+// Перевод списка, например товаров заказа: каждый элемент массива From переводится
+// в элемент списка заказа. Пути в Fields и Defaults задаются относительно элемента
+type ListMapping struct {
+	From     string            `json:"from"`
+	Fields   map[string]string `json:"fields"`
+	Defaults map[string]any    `json:"defaults"`
+}
+
+// Читает описание перевода из JSON файла и проверяет все пути в нем
+func LoadMapping(path string) (*Mapping, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mapping %s: %w", path, err)
+	}
+
+	var mapping Mapping
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&mapping); err != nil {
+		return nil, fmt.Errorf("failed to parse mapping %s: %w", path, err)
+	}
+	if err := mapping.validate(); err != nil {
+		return nil, fmt.Errorf("invalid mapping %s: %w", path, err)
+	}
+
+	return &mapping, nil
+}
+
+func (m *Mapping) validate() error {
+	if err := validatePaths(m.Fields, m.Defaults); err != nil {
+		return err
+	}
+	for target, list := range m.Lists {
+		if _, err := model.ParseJSONPointer(target); err != nil || target == "" {
+			return fmt.Errorf("list %q: invalid target pointer", target)
+		}
+		if _, err := model.ParseJSONPointer(list.From); err != nil {
+			return fmt.Errorf("list %q: from: %w", target, err)
+		}
+		if err := validatePaths(list.Fields, list.Defaults); err != nil {
+			return fmt.Errorf("list %q: %w", target, err)
+		}
+	}
+	return nil
+}
+
+func validatePaths(fields map[string]string, defaults map[string]any) error {
+	for target, from := range fields {
+		if _, err := model.ParseJSONPointer(target); err != nil || target == "" {
+			return fmt.Errorf("field %q: invalid target pointer", target)
+		}
+		if _, err := model.ParseJSONPointer(from); err != nil {
+			return fmt.Errorf("field %q: %w", target, err)
+		}
+	}
+	for target := range defaults {
+		if _, err := model.ParseJSONPointer(target); err != nil || target == "" {
+			return fmt.Errorf("default %q: invalid target pointer", target)
+		}
+	}
+	return nil
+}
+
+// Переводит JSON сообщение в заказ и возвращает событие order.created.
+// Версия схемы не учитывается: формат сообщения задает само описание перевода
+func (m *Mapping) Decode(format Format, data []byte) (*model.OrderEvent, error) {
+	if format.ContentType != ContentTypeJSON {
+		return nil, fmt.Errorf("%w: mapped topics accept only %s, got %s", ErrUnsupportedFormat, ContentTypeJSON, format.ContentType)
+	}
+
+	var src any
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&src); err != nil {
+		return nil, fmt.Errorf("%w: failed to unmarshal message: %w", ErrMalformed, err)
+	}
+
+	target := make(map[string]any)
+	applyFields(target, src, m.Fields, m.Defaults)
+
+	for to, list := range m.Lists {
+		value, ok := lookupPointer(src, list.From)
+		if !ok || value == nil {
+			continue
+		}
+		elems, ok := value.([]any)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s is not an array", ErrMalformed, list.From)
+		}
+
+		items := make([]any, 0, len(elems))
+		for _, elem := range elems {
+			item := make(map[string]any)
+			applyFields(item, elem, list.Fields, list.Defaults)
+			items = append(items, item)
+		}
+		setPointer(target, to, items)
+	}
+
+	mapped, err := json.Marshal(target)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to marshal mapped order: %w", ErrMalformed, err)
+	}
+
+	var order model.Order
+	if err := json.Unmarshal(mapped, &order); err != nil {
+		return nil, fmt.Errorf("%w: mapped order does not match order schema: %w", ErrMalformed, err)
+	}
+
+	return orderCreated(&order, nil)
+}
+
+func applyFields(target map[string]any, src any, fields map[string]string, defaults map[string]any) {
+	for to, value := range defaults {
+		setPointer(target, to, value)
+	}
+	for to, from := range fields {
+		if value, ok := lookupPointer(src, from); ok && value != nil {
+			setPointer(target, to, value)
+		}
+	}
+}
+
+func lookupPointer(doc any, pointer string) (any, bool) {
+	tokens, _ := model.ParseJSONPointer(pointer)
+	for _, token := range tokens {
+		switch node := doc.(type) {
+		case map[string]any:
+			value, ok := node[token]
+			if !ok {
+				return nil, false
+			}
+			doc = value
+		case []any:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			doc = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+// Записывает значение по пути, создавая недостающие объекты. В заказе массивы
+// собираются только из Lists, поэтому все промежуточные узлы - объекты
+func setPointer(doc map[string]any, pointer string, value any) {
+	tokens, _ := model.ParseJSONPointer(pointer)
+	for _, token := range tokens[:len(tokens)-1] {
+		next, ok := doc[token].(map[string]any)
+		if !ok {
+			next = make(map[string]any)
+			doc[token] = next
+		}
+		doc = next
+	}
+	doc[tokens[len(tokens)-1]] = value
+}
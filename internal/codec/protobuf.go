@@ -0,0 +1,251 @@
+package codec
+
+import (
+	"fmt"
+	"time"
+
+	"orders-service/internal/app/model"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Версия схемы Protobuf, если она не указана в заголовках
+const defaultProtobufVersion = 1
+
+// Декодирует заказ по схеме schemas/order.v1.proto. Сообщения разбираются напрямую
+// из wire-формата, поэтому генерировать код из .proto не нужно. Неизвестные поля
+// пропускаются, так что новые поля в схеме не ломают старых консьюмеров
+func decodeProtobuf(version int, data []byte) (*model.Order, error) {
+	if version == 0 {
+		version = defaultProtobufVersion
+	}
+	if version != 1 {
+		return nil, fmt.Errorf("%w: %s schema version %d", ErrUnsupportedFormat, ContentTypeProtobuf, version)
+	}
+
+	order := &model.Order{}
+	if err := decodeProtoOrder(data, order); err != nil {
+		return nil, fmt.Errorf("%w: failed to decode protobuf order: %w", ErrMalformed, err)
+	}
+	return order, nil
+}
+
+func decodeProtoOrder(data []byte, o *model.Order) error {
+	return rangeProtoFields(data, func(f protoField) error {
+		switch f.num {
+		case 1:
+			return f.string(&o.OrderUID)
+		case 2:
+			return f.string(&o.TrackNumber)
+		case 3:
+			return f.string(&o.Entry)
+		case 4:
+			return f.message("delivery", func(b []byte) error { return decodeProtoDelivery(b, &o.Delivery) })
+		case 5:
+			return f.message("payment", func(b []byte) error { return decodeProtoPayment(b, &o.Payment) })
+		case 6:
+			return f.message("items", func(b []byte) error {
+				var item model.Item
+				if err := decodeProtoItem(b, &item); err != nil {
+					return err
+				}
+				o.Items = append(o.Items, item)
+				return nil
+			})
+		case 7:
+			return f.string(&o.Locale)
+		case 8:
+			return f.string(&o.InternalSignature)
+		case 9:
+			return f.string(&o.CustomerID)
+		case 10:
+			return f.string(&o.DeliveryService)
+		case 11:
+			return f.string(&o.Shardkey)
+		case 12:
+			return f.int(&o.SmID)
+		case 13:
+			return f.message("date_created", func(b []byte) error { return decodeProtoTimestamp(b, &o.DateCreated) })
+		case 14:
+			return f.string(&o.OofShard)
+		}
+		return nil
+	})
+}
+
+func decodeProtoDelivery(data []byte, d *model.Delivery) error {
+	return rangeProtoFields(data, func(f protoField) error {
+		switch f.num {
+		case 1:
+			return f.string(&d.Name)
+		case 2:
+			return f.string(&d.Phone)
+		case 3:
+			return f.string(&d.Zip)
+		case 4:
+			return f.string(&d.City)
+		case 5:
+			return f.string(&d.Address)
+		case 6:
+			return f.string(&d.Region)
+		case 7:
+			return f.string(&d.Email)
+		}
+		return nil
+	})
+}
+
+func decodeProtoPayment(data []byte, p *model.Payment) error {
+	return rangeProtoFields(data, func(f protoField) error {
+		switch f.num {
+		case 1:
+			return f.string(&p.Transaction)
+		case 2:
+			return f.string(&p.RequestID)
+		case 3:
+			return f.string(&p.Currency)
+		case 4:
+			return f.string(&p.Provider)
+		case 5:
+			return f.int(&p.Amount)
+		case 6:
+			return f.int64(&p.PaymentDt)
+		case 7:
+			return f.string(&p.Bank)
+		case 8:
+			return f.int(&p.DeliveryCost)
+		case 9:
+			return f.int(&p.GoodsTotal)
+		case 10:
+			return f.int(&p.CustomFee)
+		}
+		return nil
+	})
+}
+
+func decodeProtoItem(data []byte, i *model.Item) error {
+	return rangeProtoFields(data, func(f protoField) error {
+		switch f.num {
+		case 1:
+			return f.int(&i.ChrtID)
+		case 2:
+			return f.string(&i.TrackNumber)
+		case 3:
+			return f.int(&i.Price)
+		case 4:
+			return f.string(&i.Rid)
+		case 5:
+			return f.string(&i.Name)
+		case 6:
+			return f.int(&i.Sale)
+		case 7:
+			return f.string(&i.Size)
+		case 8:
+			return f.int(&i.TotalPrice)
+		case 9:
+			return f.int(&i.NmID)
+		case 10:
+			return f.string(&i.Brand)
+		case 11:
+			return f.int(&i.Status)
+		}
+		return nil
+	})
+}
+
+// google.protobuf.Timestamp: seconds = 1, nanos = 2
+func decodeProtoTimestamp(data []byte, t *time.Time) error {
+	var seconds, nanos int64
+	err := rangeProtoFields(data, func(f protoField) error {
+		switch f.num {
+		case 1:
+			return f.int64(&seconds)
+		case 2:
+			return f.int64(&nanos)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	*t = time.Unix(seconds, nanos).UTC()
+	return nil
+}
+
+// Поле сообщения в wire-формате: varint для чисел, bytes для строк и вложенных сообщений
+type protoField struct {
+	num    protowire.Number
+	typ    protowire.Type
+	varint uint64
+	bytes  []byte
+}
+
+// Вызывает fn для каждого поля сообщения по порядку
+func rangeProtoFields(data []byte, fn func(f protoField) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		f := protoField{num: num, typ: typ}
+		switch typ {
+		case protowire.VarintType:
+			f.varint, n = protowire.ConsumeVarint(data)
+		case protowire.BytesType:
+			f.bytes, n = protowire.ConsumeBytes(data)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+		}
+		if n < 0 {
+			return fmt.Errorf("field %d: %w", num, protowire.ParseError(n))
+		}
+		data = data[n:]
+
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f protoField) string(dst *string) error {
+	if f.typ != protowire.BytesType {
+		return f.wrongType()
+	}
+	*dst = string(f.bytes)
+	return nil
+}
+
+func (f protoField) int64(dst *int64) error {
+	if f.typ != protowire.VarintType {
+		return f.wrongType()
+	}
+	*dst = int64(f.varint)
+	return nil
+}
+
+func (f protoField) int(dst *int) error {
+	var v int64
+	if err := f.int64(&v); err != nil {
+		return err
+	}
+	*dst = int(v)
+	return nil
+}
+
+func (f protoField) message(name string, decode func([]byte) error) error {
+	if f.typ != protowire.BytesType {
+		return f.wrongType()
+	}
+	if err := decode(f.bytes); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+func (f protoField) wrongType() error {
+	return fmt.Errorf("field %d: unexpected wire type %d", f.num, f.typ)
+}
@@ -0,0 +1,4 @@
+
+b563feb7b2b84b6testWBILMTESTTRACKWBIL"[
+Test Testov+97200000002639809"Kiryat Mozkin*Ploshad Mira 152Kraiot:test@gmail.com*J
+b563feb7b2b84b6testreq-1USD"wbpay(0/:alpha@HP2XҰWBILMTESTTRACK"ab4219087a764ae0btest*Mascaras0:0@HRVivienne SaboX2jWBILMTESTTRACK"ab4219087a764ae0btest2*Гель для душа:MH RЧистая линияX:enBsigJtestRmeestZ9`cj:r1
\ No newline at end of file
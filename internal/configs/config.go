@@ -3,8 +3,10 @@ package configs
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 	"go.uber.org/zap"
@@ -12,19 +14,179 @@ import (
 
 type AppConfig struct {
 	App
+	Source
 	Kafka
+	Consumer
+	Codec
+	Validation
+	Outbox
 	Database
 }
 
 type App struct {
-	Port      int
-	CacheSize int
+	Port int
+	// Токен административных эндпоинтов /admin/*, пустой - эндпоинты выключены
+	AdminToken string
+	// Ограничения кэша в заказах и в оценочном размере заказов в байтах, 0 - ограничения нет.
+	// Задано должно быть хотя бы одно
+	CacheSize     int
+	CacheMaxBytes int64
+	CachePolicy   string
+	// Срок жизни заказа в кэше, 0 - заказы не устаревают
+	CacheTTL             time.Duration
+	CacheJanitorInterval time.Duration
+}
+
+// Политики вытеснения кэша заказов
+const (
+	CachePolicyLRU     = "lru"
+	CachePolicyLFU     = "lfu"
+	CachePolicyTinyLFU = "tinylfu"
+)
+
+// Типы источников заказов
+const (
+	SourceKafka = "kafka"
+	SourceSpool = "spool"
+)
+
+type Source struct {
+	Type              string
+	SpoolDir          string
+	SpoolPollInterval time.Duration
+}
+
+// Где хранятся оффсеты прочитанных из Kafka сообщений
+const (
+	// Оффсеты коммитятся в consumer group брокера
+	OffsetStorageBroker = "broker"
+	// Оффсеты сохраняются в Postgres в одной транзакции с заказом
+	OffsetStoragePostgres = "postgres"
+)
+
+// SASL механизмы аутентификации в Kafka
+const (
+	SASLScramSHA256 = "SCRAM-SHA-256"
+	SASLScramSHA512 = "SCRAM-SHA-512"
+)
+
+// Стратегии распределения партиций между участниками consumer group
+const (
+	RebalanceRange      = "range"
+	RebalanceRoundRobin = "roundrobin"
+)
+
+// С какого оффсета читать партицию, для которой у группы еще нет оффсета
+const (
+	StartOffsetEarliest = "earliest"
+	StartOffsetLatest   = "latest"
+)
+
+// Наборы проверок заказа
+const (
+	// Все проверки сервиса
+	ValidationStrict = "strict"
+	// Без полей, которые маркетплейсы могут не передавать: track_number,
+	// имени получателя, транзакции оплаты и goods_total
+	ValidationRelaxed = "relaxed"
+)
+
+// Топик с заказами и способ обработки его сообщений
+type KafkaTopic struct {
+	Name string
+	// JSON файл с переводом заказа маркетплейса в формат сервиса.
+	// Пустая строка - сообщения уже в формате сервиса
+	MappingFile       string
+	ValidationProfile string
 }
 
 type Kafka struct {
-	Brokers []string
-	Topic   string
-	GroupID string
+	Brokers       []string
+	Topics        []KafkaTopic
+	GroupID       string
+	DLQTopic      string
+	OffsetStorage string
+
+	// Аутентификация и шифрование. Пустой SASLMechanism означает подключение без SASL,
+	// TLSCertFile и TLSKeyFile задают клиентский сертификат для mTLS
+	SASLMechanism string
+	SASLUsername  string
+	SASLPassword  string
+	TLSEnabled    bool
+	TLSCAFile     string
+	TLSCertFile   string
+	TLSKeyFile    string
+
+	// Настройки чтения
+	MinBytes          int
+	MaxBytes          int
+	MaxWait           time.Duration
+	SessionTimeout    time.Duration
+	RebalanceStrategy string
+	StartOffset       string
+}
+
+// Способы распределения сообщений по воркерам
+const (
+	// Все сообщения партиции обрабатывает один воркер
+	OrderingPartition = "partition"
+	// Сообщения с одним ключом (order_uid) обрабатывает один воркер,
+	// сообщения без ключа распределяются по партиции
+	OrderingKey = "key"
+)
+
+// Настройки обработки сообщений, общие для всех источников
+type Consumer struct {
+	Workers      int
+	Ordering     string
+	BatchSize    int
+	BatchTimeout time.Duration
+
+	RetryInitialBackoff time.Duration
+	RetryMaxBackoff     time.Duration
+	RetryMaxAttempts    int
+
+	// Группа, оффсеты которой сохраняются в БД вместе с результатом обработки.
+	// Пустая строка означает, что оффсеты коммитятся в источник
+	OffsetGroup string
+}
+
+// Настройки декодирования сообщений. Встроенные схемы Avro можно дополнить
+// файлами order.v<N>.avsc из AvroSchemaDir
+type Codec struct {
+	AvroSchemaDir string
+}
+
+// Режимы правил проверки заказа
+const (
+	// Заказ отклоняется как невалидный
+	RuleReject = "reject"
+	// Нарушение пишется в лог, заказ сохраняется
+	RuleWarn = "warn"
+	// Правило не проверяется
+	RuleOff = "off"
+)
+
+// Режимы правил согласованности сумм и полей заказа
+type Validation struct {
+	GoodsTotalRule      string
+	AmountRule          string
+	ItemTotalPriceRule  string
+	ItemTrackNumberRule string
+	// Файл с дополнительными правилами проверки, пустой - правил нет
+	RulesFile string
+}
+
+// Публикация событий order.persisted из outbox. Пустой Topic выключает outbox
+type Outbox struct {
+	Topic        string
+	PollInterval time.Duration
+	BatchSize    int
+	// На сколько забранные события закрепляются за relay
+	Lease time.Duration
+
+	RetryInitialBackoff time.Duration
+	RetryMaxBackoff     time.Duration
 }
 
 type Database struct {
@@ -51,20 +213,78 @@ func NewConfig(logger *zap.Logger) (*AppConfig, error) {
 	if err != nil {
 		return nil, fmt.Errorf("CACHE_SIZE is not defined or invalid: %w", err)
 	}
+	if cacheSize < 0 {
+		return nil, fmt.Errorf("CACHE_SIZE must not be negative, got %d", cacheSize)
+	}
+	cacheMaxBytes, err := intEnvOrDefault("CACHE_MAX_BYTES", 0)
+	if err != nil {
+		return nil, err
+	}
+	if cacheMaxBytes < 0 {
+		return nil, fmt.Errorf("CACHE_MAX_BYTES must not be negative, got %d", cacheMaxBytes)
+	}
+	if cacheSize == 0 && cacheMaxBytes == 0 {
+		return nil, fmt.Errorf("CACHE_SIZE or CACHE_MAX_BYTES must be positive")
+	}
 
-	kafkaBrokers := os.Getenv("KAFKA_BROKERS")
-	if kafkaBrokers == "" {
-		return nil, fmt.Errorf("KAFKA_BROKERS is not defined ")
+	cachePolicy := strings.ToLower(os.Getenv("CACHE_POLICY"))
+	switch cachePolicy {
+	case "":
+		cachePolicy = CachePolicyLRU
+	case CachePolicyLRU, CachePolicyLFU, CachePolicyTinyLFU:
+	default:
+		return nil, fmt.Errorf("CACHE_POLICY must be %q, %q or %q, got %q", CachePolicyLRU, CachePolicyLFU, CachePolicyTinyLFU, cachePolicy)
+	}
+
+	cacheTTLMs, err := intEnvOrDefault("CACHE_TTL_MS", 0)
+	if err != nil {
+		return nil, err
+	}
+	if cacheTTLMs < 0 {
+		return nil, fmt.Errorf("CACHE_TTL_MS must not be negative, got %d", cacheTTLMs)
+	}
+	cacheJanitorIntervalMs, err := intEnvOrDefault("CACHE_JANITOR_INTERVAL_MS", 60000)
+	if err != nil {
+		return nil, err
+	}
+	if cacheJanitorIntervalMs <= 0 {
+		return nil, fmt.Errorf("CACHE_JANITOR_INTERVAL_MS must be positive, got %d", cacheJanitorIntervalMs)
+	}
+
+	sourceCfg, err := newSourceConfig()
+	if err != nil {
+		return nil, err
 	}
 
-	kafkaTopic := os.Getenv("KAFKA_TOPIC")
-	if kafkaTopic == "" {
-		return nil, fmt.Errorf("KAFKA_TOPIC is not defined")
+	kafkaCfg, err := newKafkaConfig(sourceCfg.Type)
+	if err != nil {
+		return nil, err
 	}
 
-	kafkaGroupID := os.Getenv("KAFKA_GROUP_ID")
-	if kafkaGroupID == "" {
-		return nil, fmt.Errorf("KAFKA_GROUP_ID is not defined")
+	consumerCfg, err := newConsumerConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if kafkaCfg.OffsetStorage == OffsetStoragePostgres {
+		if sourceCfg.Type != SourceKafka {
+			return nil, fmt.Errorf("KAFKA_OFFSET_STORAGE=%s requires ORDER_SOURCE=%s", OffsetStoragePostgres, SourceKafka)
+		}
+		// Оффсет партиции сдвигается после каждого сообщения, поэтому партицию должен обрабатывать один воркер
+		if consumerCfg.Ordering != OrderingPartition {
+			return nil, fmt.Errorf("KAFKA_OFFSET_STORAGE=%s requires KAFKA_ORDERING=%s", OffsetStoragePostgres, OrderingPartition)
+		}
+		consumerCfg.OffsetGroup = kafkaCfg.GroupID
+	}
+
+	validationCfg, err := newValidationConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	outboxCfg, err := newOutboxConfig(kafkaCfg)
+	if err != nil {
+		return nil, err
 	}
 
 	dbHost := os.Getenv("POSTGRES_HOST")
@@ -94,14 +314,23 @@ func NewConfig(logger *zap.Logger) (*AppConfig, error) {
 
 	return &AppConfig{
 		App: App{
-			Port:      appPort,
-			CacheSize: cacheSize,
+			Port:          appPort,
+			AdminToken:    os.Getenv("ADMIN_TOKEN"),
+			CacheSize:     cacheSize,
+			CacheMaxBytes: int64(cacheMaxBytes),
+			CachePolicy:   cachePolicy,
+
+			CacheTTL:             time.Duration(cacheTTLMs) * time.Millisecond,
+			CacheJanitorInterval: time.Duration(cacheJanitorIntervalMs) * time.Millisecond,
 		},
-		Kafka: Kafka{
-			Brokers: strings.Split(kafkaBrokers, ","),
-			Topic:   kafkaTopic,
-			GroupID: kafkaGroupID,
+		Source:   *sourceCfg,
+		Kafka:    *kafkaCfg,
+		Consumer: *consumerCfg,
+		Codec: Codec{
+			AvroSchemaDir: os.Getenv("AVRO_SCHEMA_DIR"),
 		},
+		Validation: *validationCfg,
+		Outbox:     *outboxCfg,
 		Database: Database{
 			Host:     dbHost,
 			Port:     dbPort,
@@ -112,3 +341,472 @@ func NewConfig(logger *zap.Logger) (*AppConfig, error) {
 		},
 	}, nil
 }
+
+func newSourceConfig() (*Source, error) {
+	sourceType := os.Getenv("ORDER_SOURCE")
+	switch sourceType {
+	case "":
+		sourceType = SourceKafka
+	case SourceKafka, SourceSpool:
+	default:
+		return nil, fmt.Errorf("ORDER_SOURCE must be %q or %q, got %q", SourceKafka, SourceSpool, sourceType)
+	}
+
+	spoolDir := os.Getenv("SPOOL_DIR")
+	if sourceType == SourceSpool && spoolDir == "" {
+		return nil, fmt.Errorf("SPOOL_DIR is not defined")
+	}
+
+	spoolPollIntervalMs, err := intEnvOrDefault("SPOOL_POLL_INTERVAL_MS", 1000)
+	if err != nil {
+		return nil, err
+	}
+	if spoolPollIntervalMs <= 0 {
+		return nil, fmt.Errorf("SPOOL_POLL_INTERVAL_MS must be positive, got %d", spoolPollIntervalMs)
+	}
+
+	return &Source{
+		Type:              sourceType,
+		SpoolDir:          spoolDir,
+		SpoolPollInterval: time.Duration(spoolPollIntervalMs) * time.Millisecond,
+	}, nil
+}
+
+// Имена топиков с заказами
+func (k Kafka) TopicNames() []string {
+	names := make([]string, 0, len(k.Topics))
+	for _, topic := range k.Topics {
+		names = append(names, topic.Name)
+	}
+	return names
+}
+
+// Топики и группа обязательны только для чтения из Kafka, брокеры - еще и для dead-letter топика
+func newKafkaConfig(sourceType string) (*Kafka, error) {
+	topics, err := loadKafkaTopics()
+	if err != nil {
+		return nil, err
+	}
+	if len(topics) == 0 && sourceType == SourceKafka {
+		return nil, fmt.Errorf("neither KAFKA_TOPICS nor KAFKA_TOPIC is defined")
+	}
+
+	kafkaGroupID := os.Getenv("KAFKA_GROUP_ID")
+	if kafkaGroupID == "" && sourceType == SourceKafka {
+		return nil, fmt.Errorf("KAFKA_GROUP_ID is not defined")
+	}
+
+	// Dead-letter топик необязателен: без него необработанные сообщения сохраняются только в карантин
+	kafkaDLQTopic := os.Getenv("KAFKA_DLQ_TOPIC")
+	for _, topic := range topics {
+		if kafkaDLQTopic != "" && kafkaDLQTopic == topic.Name {
+			return nil, fmt.Errorf("KAFKA_DLQ_TOPIC must differ from order topics")
+		}
+	}
+
+	kafkaBrokers := os.Getenv("KAFKA_BROKERS")
+	if kafkaBrokers == "" && (sourceType == SourceKafka || kafkaDLQTopic != "") {
+		return nil, fmt.Errorf("KAFKA_BROKERS is not defined ")
+	}
+
+	var brokers []string
+	if kafkaBrokers != "" {
+		brokers = strings.Split(kafkaBrokers, ",")
+	}
+
+	offsetStorage := os.Getenv("KAFKA_OFFSET_STORAGE")
+	switch offsetStorage {
+	case "":
+		offsetStorage = OffsetStorageBroker
+	case OffsetStorageBroker, OffsetStoragePostgres:
+	default:
+		return nil, fmt.Errorf("KAFKA_OFFSET_STORAGE must be %q or %q, got %q", OffsetStorageBroker, OffsetStoragePostgres, offsetStorage)
+	}
+
+	kafkaCfg := &Kafka{
+		Brokers:       brokers,
+		Topics:        topics,
+		GroupID:       kafkaGroupID,
+		DLQTopic:      kafkaDLQTopic,
+		OffsetStorage: offsetStorage,
+	}
+	if err := loadKafkaSecurity(kafkaCfg); err != nil {
+		return nil, err
+	}
+	if err := loadKafkaReaderSettings(kafkaCfg); err != nil {
+		return nil, err
+	}
+
+	return kafkaCfg, nil
+}
+
+// Читает список топиков из KAFKA_TOPICS в виде topic[:mapping[:profile]] через запятую,
+// например orders,market-orders:market:relaxed. mapping - имя файла <mapping>.json
+// в KAFKA_TOPIC_MAPPING_DIR. Без KAFKA_TOPICS читается один топик KAFKA_TOPIC
+func loadKafkaTopics() ([]KafkaTopic, error) {
+	list := os.Getenv("KAFKA_TOPICS")
+	single := os.Getenv("KAFKA_TOPIC")
+	if list == "" {
+		if single == "" {
+			return nil, nil
+		}
+		return []KafkaTopic{{Name: single, ValidationProfile: ValidationStrict}}, nil
+	}
+	if single != "" {
+		return nil, fmt.Errorf("KAFKA_TOPICS and KAFKA_TOPIC must not be set together")
+	}
+
+	mappingDir := os.Getenv("KAFKA_TOPIC_MAPPING_DIR")
+	seen := make(map[string]bool)
+	var topics []KafkaTopic
+	for _, spec := range strings.Split(list, ",") {
+		parts := strings.Split(strings.TrimSpace(spec), ":")
+		if len(parts) > 3 || parts[0] == "" {
+			return nil, fmt.Errorf("KAFKA_TOPICS entry must be topic[:mapping[:profile]], got %q", spec)
+		}
+		parts = append(parts, "", "")
+
+		topic := KafkaTopic{Name: parts[0], ValidationProfile: parts[2]}
+		if seen[topic.Name] {
+			return nil, fmt.Errorf("KAFKA_TOPICS lists topic %q twice", topic.Name)
+		}
+		seen[topic.Name] = true
+
+		if mapping := parts[1]; mapping != "" {
+			if mappingDir == "" {
+				return nil, fmt.Errorf("KAFKA_TOPIC_MAPPING_DIR is not defined, but required by mapping %q of topic %q", mapping, topic.Name)
+			}
+			topic.MappingFile = filepath.Join(mappingDir, mapping+".json")
+			if _, err := os.Stat(topic.MappingFile); err != nil {
+				return nil, fmt.Errorf("mapping %q of topic %q is not readable: %w", mapping, topic.Name, err)
+			}
+		}
+
+		switch topic.ValidationProfile {
+		case "":
+			topic.ValidationProfile = ValidationStrict
+		case ValidationStrict, ValidationRelaxed:
+		default:
+			return nil, fmt.Errorf("validation profile of topic %q must be %q or %q, got %q",
+				topic.Name, ValidationStrict, ValidationRelaxed, topic.ValidationProfile)
+		}
+
+		topics = append(topics, topic)
+	}
+
+	return topics, nil
+}
+
+func loadKafkaSecurity(cfg *Kafka) error {
+	cfg.SASLMechanism = strings.ToUpper(os.Getenv("KAFKA_SASL_MECHANISM"))
+	cfg.SASLUsername = os.Getenv("KAFKA_SASL_USERNAME")
+	cfg.SASLPassword = os.Getenv("KAFKA_SASL_PASSWORD")
+	switch cfg.SASLMechanism {
+	case "":
+		if cfg.SASLUsername != "" || cfg.SASLPassword != "" {
+			return fmt.Errorf("KAFKA_SASL_USERNAME and KAFKA_SASL_PASSWORD require KAFKA_SASL_MECHANISM")
+		}
+	case SASLScramSHA256, SASLScramSHA512:
+		if cfg.SASLUsername == "" || cfg.SASLPassword == "" {
+			return fmt.Errorf("KAFKA_SASL_MECHANISM=%s requires KAFKA_SASL_USERNAME and KAFKA_SASL_PASSWORD", cfg.SASLMechanism)
+		}
+	default:
+		return fmt.Errorf("KAFKA_SASL_MECHANISM must be %q or %q, got %q", SASLScramSHA256, SASLScramSHA512, cfg.SASLMechanism)
+	}
+
+	tlsEnabled, err := boolEnvOrDefault("KAFKA_TLS_ENABLED", false)
+	if err != nil {
+		return err
+	}
+	cfg.TLSEnabled = tlsEnabled
+	cfg.TLSCAFile = os.Getenv("KAFKA_TLS_CA_FILE")
+	cfg.TLSCertFile = os.Getenv("KAFKA_TLS_CERT_FILE")
+	cfg.TLSKeyFile = os.Getenv("KAFKA_TLS_KEY_FILE")
+
+	tlsFiles := []struct{ name, path string }{
+		{"KAFKA_TLS_CA_FILE", cfg.TLSCAFile},
+		{"KAFKA_TLS_CERT_FILE", cfg.TLSCertFile},
+		{"KAFKA_TLS_KEY_FILE", cfg.TLSKeyFile},
+	}
+	for _, file := range tlsFiles {
+		if file.path == "" {
+			continue
+		}
+		if !cfg.TLSEnabled {
+			return fmt.Errorf("%s is set, but KAFKA_TLS_ENABLED is not true", file.name)
+		}
+		if _, err := os.Stat(file.path); err != nil {
+			return fmt.Errorf("%s is not readable: %w", file.name, err)
+		}
+	}
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		return fmt.Errorf("KAFKA_TLS_CERT_FILE and KAFKA_TLS_KEY_FILE must be set together")
+	}
+
+	return nil
+}
+
+func loadKafkaReaderSettings(cfg *Kafka) error {
+	minBytes, err := intEnvOrDefault("KAFKA_MIN_BYTES", 1)
+	if err != nil {
+		return err
+	}
+	maxBytes, err := intEnvOrDefault("KAFKA_MAX_BYTES", 10<<20)
+	if err != nil {
+		return err
+	}
+	if minBytes < 1 || maxBytes < minBytes {
+		return fmt.Errorf("KAFKA_MIN_BYTES must be positive and not greater than KAFKA_MAX_BYTES, got %d and %d", minBytes, maxBytes)
+	}
+
+	maxWaitMs, err := intEnvOrDefault("KAFKA_MAX_WAIT_MS", 10000)
+	if err != nil {
+		return err
+	}
+	if maxWaitMs <= 0 {
+		return fmt.Errorf("KAFKA_MAX_WAIT_MS must be positive, got %d", maxWaitMs)
+	}
+
+	// Брокер по умолчанию принимает таймаут сессии от 6 до 300 секунд
+	sessionTimeoutMs, err := intEnvOrDefault("KAFKA_SESSION_TIMEOUT_MS", 30000)
+	if err != nil {
+		return err
+	}
+	if sessionTimeoutMs < 6000 || sessionTimeoutMs > 300000 {
+		return fmt.Errorf("KAFKA_SESSION_TIMEOUT_MS must be between 6000 and 300000, got %d", sessionTimeoutMs)
+	}
+
+	rebalanceStrategy := strings.ToLower(os.Getenv("KAFKA_REBALANCE_STRATEGY"))
+	switch rebalanceStrategy {
+	case "":
+		rebalanceStrategy = RebalanceRange
+	case RebalanceRange, RebalanceRoundRobin:
+	default:
+		return fmt.Errorf("KAFKA_REBALANCE_STRATEGY must be %q or %q, got %q", RebalanceRange, RebalanceRoundRobin, rebalanceStrategy)
+	}
+
+	startOffset := strings.ToLower(os.Getenv("KAFKA_START_OFFSET"))
+	switch startOffset {
+	case "":
+		startOffset = StartOffsetEarliest
+	case StartOffsetEarliest, StartOffsetLatest:
+	default:
+		return fmt.Errorf("KAFKA_START_OFFSET must be %q or %q, got %q", StartOffsetEarliest, StartOffsetLatest, startOffset)
+	}
+
+	cfg.MinBytes = minBytes
+	cfg.MaxBytes = maxBytes
+	cfg.MaxWait = time.Duration(maxWaitMs) * time.Millisecond
+	cfg.SessionTimeout = time.Duration(sessionTimeoutMs) * time.Millisecond
+	cfg.RebalanceStrategy = rebalanceStrategy
+	cfg.StartOffset = startOffset
+
+	return nil
+}
+
+func newConsumerConfig() (*Consumer, error) {
+	workers, err := intEnvOrDefault("KAFKA_WORKERS", 1)
+	if err != nil {
+		return nil, err
+	}
+	if workers < 1 {
+		return nil, fmt.Errorf("KAFKA_WORKERS must be at least 1, got %d", workers)
+	}
+
+	ordering := strings.ToLower(os.Getenv("KAFKA_ORDERING"))
+	switch ordering {
+	case "":
+		ordering = OrderingPartition
+	case OrderingPartition, OrderingKey:
+	default:
+		return nil, fmt.Errorf("KAFKA_ORDERING must be %q or %q, got %q", OrderingPartition, OrderingKey, ordering)
+	}
+
+	batchSize, err := intEnvOrDefault("KAFKA_BATCH_SIZE", 1)
+	if err != nil {
+		return nil, err
+	}
+	if batchSize < 1 {
+		return nil, fmt.Errorf("KAFKA_BATCH_SIZE must be at least 1, got %d", batchSize)
+	}
+
+	batchTimeoutMs, err := intEnvOrDefault("KAFKA_BATCH_TIMEOUT_MS", 100)
+	if err != nil {
+		return nil, err
+	}
+	if batchTimeoutMs <= 0 {
+		return nil, fmt.Errorf("KAFKA_BATCH_TIMEOUT_MS must be positive, got %d", batchTimeoutMs)
+	}
+
+	retryInitialBackoffMs, err := intEnvOrDefault("KAFKA_RETRY_INITIAL_BACKOFF_MS", 200)
+	if err != nil {
+		return nil, err
+	}
+	retryMaxBackoffMs, err := intEnvOrDefault("KAFKA_RETRY_MAX_BACKOFF_MS", 30000)
+	if err != nil {
+		return nil, err
+	}
+	if retryInitialBackoffMs <= 0 || retryMaxBackoffMs < retryInitialBackoffMs {
+		return nil, fmt.Errorf("KAFKA_RETRY_INITIAL_BACKOFF_MS must be positive and not greater than KAFKA_RETRY_MAX_BACKOFF_MS, got %d and %d",
+			retryInitialBackoffMs, retryMaxBackoffMs)
+	}
+
+	retryMaxAttempts, err := intEnvOrDefault("KAFKA_RETRY_MAX_ATTEMPTS", 3)
+	if err != nil {
+		return nil, err
+	}
+	if retryMaxAttempts < 1 {
+		return nil, fmt.Errorf("KAFKA_RETRY_MAX_ATTEMPTS must be at least 1, got %d", retryMaxAttempts)
+	}
+
+	return &Consumer{
+		Workers:      workers,
+		Ordering:     ordering,
+		BatchSize:    batchSize,
+		BatchTimeout: time.Duration(batchTimeoutMs) * time.Millisecond,
+
+		RetryInitialBackoff: time.Duration(retryInitialBackoffMs) * time.Millisecond,
+		RetryMaxBackoff:     time.Duration(retryMaxBackoffMs) * time.Millisecond,
+		RetryMaxAttempts:    retryMaxAttempts,
+	}, nil
+}
+
+func newValidationConfig() (*Validation, error) {
+	goodsTotal, err := ruleModeEnv("VALIDATION_GOODS_TOTAL")
+	if err != nil {
+		return nil, err
+	}
+	amount, err := ruleModeEnv("VALIDATION_AMOUNT")
+	if err != nil {
+		return nil, err
+	}
+	itemTotalPrice, err := ruleModeEnv("VALIDATION_ITEM_TOTAL_PRICE")
+	if err != nil {
+		return nil, err
+	}
+	itemTrackNumber, err := ruleModeEnv("VALIDATION_ITEM_TRACK_NUMBER")
+	if err != nil {
+		return nil, err
+	}
+
+	rulesFile := os.Getenv("VALIDATION_RULES_FILE")
+	if rulesFile != "" {
+		if _, err := os.Stat(rulesFile); err != nil {
+			return nil, fmt.Errorf("VALIDATION_RULES_FILE is not readable: %w", err)
+		}
+	}
+
+	return &Validation{
+		GoodsTotalRule:      goodsTotal,
+		AmountRule:          amount,
+		ItemTotalPriceRule:  itemTotalPrice,
+		ItemTrackNumberRule: itemTrackNumber,
+		RulesFile:           rulesFile,
+	}, nil
+}
+
+func newOutboxConfig(kafkaCfg *Kafka) (*Outbox, error) {
+	topic := os.Getenv("OUTBOX_TOPIC")
+	if topic != "" {
+		if len(kafkaCfg.Brokers) == 0 {
+			return nil, fmt.Errorf("KAFKA_BROKERS is not defined, but required by OUTBOX_TOPIC")
+		}
+		for _, orderTopic := range kafkaCfg.Topics {
+			if topic == orderTopic.Name {
+				return nil, fmt.Errorf("OUTBOX_TOPIC must differ from order topics")
+			}
+		}
+		if topic == kafkaCfg.DLQTopic {
+			return nil, fmt.Errorf("OUTBOX_TOPIC must differ from KAFKA_DLQ_TOPIC")
+		}
+	}
+
+	pollIntervalMs, err := intEnvOrDefault("OUTBOX_POLL_INTERVAL_MS", 1000)
+	if err != nil {
+		return nil, err
+	}
+	if pollIntervalMs <= 0 {
+		return nil, fmt.Errorf("OUTBOX_POLL_INTERVAL_MS must be positive, got %d", pollIntervalMs)
+	}
+
+	batchSize, err := intEnvOrDefault("OUTBOX_BATCH_SIZE", 100)
+	if err != nil {
+		return nil, err
+	}
+	if batchSize < 1 {
+		return nil, fmt.Errorf("OUTBOX_BATCH_SIZE must be at least 1, got %d", batchSize)
+	}
+
+	leaseMs, err := intEnvOrDefault("OUTBOX_LEASE_MS", 30000)
+	if err != nil {
+		return nil, err
+	}
+	if leaseMs <= 0 {
+		return nil, fmt.Errorf("OUTBOX_LEASE_MS must be positive, got %d", leaseMs)
+	}
+
+	retryInitialBackoffMs, err := intEnvOrDefault("OUTBOX_RETRY_INITIAL_BACKOFF_MS", 1000)
+	if err != nil {
+		return nil, err
+	}
+	retryMaxBackoffMs, err := intEnvOrDefault("OUTBOX_RETRY_MAX_BACKOFF_MS", 60000)
+	if err != nil {
+		return nil, err
+	}
+	if retryInitialBackoffMs <= 0 || retryMaxBackoffMs < retryInitialBackoffMs {
+		return nil, fmt.Errorf("OUTBOX_RETRY_INITIAL_BACKOFF_MS must be positive and not greater than OUTBOX_RETRY_MAX_BACKOFF_MS, got %d and %d",
+			retryInitialBackoffMs, retryMaxBackoffMs)
+	}
+
+	return &Outbox{
+		Topic:        topic,
+		PollInterval: time.Duration(pollIntervalMs) * time.Millisecond,
+		BatchSize:    batchSize,
+		Lease:        time.Duration(leaseMs) * time.Millisecond,
+
+		RetryInitialBackoff: time.Duration(retryInitialBackoffMs) * time.Millisecond,
+		RetryMaxBackoff:     time.Duration(retryMaxBackoffMs) * time.Millisecond,
+	}, nil
+}
+
+// Возвращает режим правила проверки. По умолчанию правило включено в режиме warn,
+// чтобы заказы старых продюсеров, у которых суммы не сходятся, не начали
+// отклоняться сразу после обновления
+func ruleModeEnv(name string) (string, error) {
+	mode := strings.ToLower(os.Getenv(name))
+	switch mode {
+	case "":
+		return RuleWarn, nil
+	case RuleReject, RuleWarn, RuleOff:
+		return mode, nil
+	}
+	return "", fmt.Errorf("%s must be %q, %q or %q, got %q", name, RuleReject, RuleWarn, RuleOff, mode)
+}
+
+// Возвращает логическое значение переменной окружения или def, если переменная не задана
+func boolEnvOrDefault(name string, def bool) (bool, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return def, nil
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("%s is invalid: %w", name, err)
+	}
+	return b, nil
+}
+
+// Возвращает целое значение переменной окружения или def, если переменная не задана
+func intEnvOrDefault(name string, def int) (int, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return def, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s is invalid: %w", name, err)
+	}
+	return n, nil
+}
@@ -0,0 +1,637 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"orders-service/internal/app/model"
+	"orders-service/internal/app/service"
+	"orders-service/internal/backoff"
+	"orders-service/internal/codec"
+	"orders-service/internal/configs"
+	"orders-service/internal/source"
+
+	"go.uber.org/zap"
+)
+
+// Методы сервиса заказов, которые нужны консьюмеру
+type OrderService interface {
+	HandleEvent(ctx context.Context, event *model.OrderEvent) (model.SaveOutcome, error)
+	SaveOrders(ctx context.Context, orders []*model.Order) ([]model.SaveOutcome, error)
+	QuarantineMessage(ctx context.Context, msg *model.FailedMessage) error
+}
+
+// Получатель сообщений, которые не удалось обработать, например dead-letter топик Kafka
+type DeadLetterPublisher interface {
+	Publish(ctx context.Context, m source.Message, kind string, cause error, attempts int) error
+	Close() error
+}
+
+// Причины, по которым сообщение попадает в карантин и dead-letter топик
+const (
+	FailureUnmarshal        = "unmarshal"
+	FailureUnsupported      = "unsupported_format"
+	FailureValidation       = "validation"
+	FailureConflict         = "conflict"
+	FailureNotApplicable    = "not_applicable"
+	FailureDataRejected     = "data_rejected"
+	FailureRetriesExhausted = "retries_exhausted"
+)
+
+const (
+	workerQueueSize = 16
+	commitTimeout   = 10 * time.Second
+)
+
+type Consumer struct {
+	source       source.OrderSource
+	decoder      *codec.Registry
+	dlq          DeadLetterPublisher
+	service      OrderService
+	logger       *zap.Logger
+	workers      int
+	ordering     string
+	batchSize    int
+	batchTimeout time.Duration
+	retry        backoff.Exponential
+	maxAttempts  int
+	offsetGroup  string
+	pauser       pauser
+	status       *statusTracker
+}
+
+// Создает консьюмер, который читает сообщения из src и декодирует их decoder'ом
+// по заголовкам сообщения. dlq может быть nil, тогда необработанные сообщения
+// сохраняются только в карантин
+func NewConsumer(cfg configs.Consumer, src source.OrderSource, decoder *codec.Registry, dlq DeadLetterPublisher, svc OrderService, logger *zap.Logger) (*Consumer, error) {
+	return &Consumer{
+		source:       src,
+		decoder:      decoder,
+		dlq:          dlq,
+		service:      svc,
+		logger:       logger,
+		workers:      cfg.Workers,
+		ordering:     cfg.Ordering,
+		batchSize:    cfg.BatchSize,
+		batchTimeout: cfg.BatchTimeout,
+		retry:        backoff.Exponential{Initial: cfg.RetryInitialBackoff, Max: cfg.RetryMaxBackoff},
+		maxAttempts:  cfg.RetryMaxAttempts,
+		offsetGroup:  cfg.OffsetGroup,
+		status:       newStatusTracker(),
+	}, nil
+}
+
+func (c *Consumer) Close() error {
+	if c.dlq != nil {
+		c.logger.Info("Closing dead-letter writer...")
+		if err := c.dlq.Close(); err != nil {
+			c.logger.Error("Failed to close dead-letter writer", zap.Error(err))
+		}
+	}
+
+	c.logger.Info("Closing order source...")
+	return c.source.Close()
+}
+
+// Останавливает чтение новых сообщений, не выходя из consumer group. Уже прочитанные
+// сообщения дообрабатываются и коммитятся. false означает, что консьюмер уже на паузе
+func (c *Consumer) Pause() bool {
+	if !c.pauser.pause() {
+		return false
+	}
+	c.logger.Info("Consumer paused")
+	return true
+}
+
+// Возобновляет чтение после Pause. false означает, что консьюмер не был на паузе
+func (c *Consumer) Resume() bool {
+	if !c.pauser.resume() {
+		return false
+	}
+	c.logger.Info("Consumer resumed")
+	return true
+}
+
+func (c *Consumer) Status() Status {
+	paused, pausedAt := c.pauser.state()
+
+	status := c.status.snapshot()
+	status.Paused = paused
+	if paused {
+		status.PausedAt = &pausedAt
+	}
+	return status
+}
+
+// Читает сообщения и раздает их пулу воркеров. Порядок обработки сохраняется
+// внутри партиции или ключа, а оффсет коммитится только после того, как все
+// сообщения до него сохранены в БД или отложены в карантин. Так при падении
+// между чтением и коммитом сообщение будет прочитано повторно, а не потеряно
+func (c *Consumer) Start(ctx context.Context) {
+	c.logger.Info("Consumer started",
+		zap.Int("workers", c.workers),
+		zap.String("ordering", c.ordering),
+		zap.Int("batch_size", c.batchSize),
+		zap.Duration("batch_timeout", c.batchTimeout),
+		zap.Bool("offsets_in_db", c.offsetGroup != ""),
+	)
+
+	tracker := newOffsetTracker()
+	done := make(chan source.Message, c.workers*workerQueueSize)
+
+	var committerWG sync.WaitGroup
+	committerWG.Add(1)
+	go func() {
+		defer committerWG.Done()
+		c.commitLoop(tracker, done)
+	}()
+
+	queues := make([]chan source.Message, c.workers)
+	var workersWG sync.WaitGroup
+	for i := range queues {
+		queues[i] = make(chan source.Message, workerQueueSize)
+		workersWG.Add(1)
+		go func(queue <-chan source.Message) {
+			defer workersWG.Done()
+			c.worker(ctx, queue, done)
+		}(queues[i])
+	}
+
+	c.fetchLoop(ctx, tracker, queues)
+
+	for _, queue := range queues {
+		close(queue)
+	}
+	workersWG.Wait()
+	close(done)
+	committerWG.Wait()
+}
+
+func (c *Consumer) fetchLoop(ctx context.Context, tracker *offsetTracker, queues []chan source.Message) {
+	for {
+		fetchCtx, ok := c.pauser.wait(ctx)
+		if !ok {
+			c.logger.Info("Context cancelled, shutting down consumer...")
+			return
+		}
+
+		m, err := c.source.Fetch(fetchCtx)
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				// Чтение прервано паузой, а не остановкой
+				if ctx.Err() == nil {
+					continue
+				}
+				c.logger.Info("Context cancelled, shutting down consumer...")
+				return
+			}
+			if errors.Is(err, source.ErrExhausted) {
+				c.logger.Info("Order source is exhausted, shutting down consumer...")
+				return
+			}
+
+			c.logger.Error("Failed to fetch message", zap.Error(err))
+			c.status.fetchFailed()
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(c.retry.Delay(1)):
+			}
+			continue
+		}
+
+		c.logger.Info("Received new message",
+			zap.String("topic", m.Topic),
+			zap.Int("partition", m.Partition),
+			zap.Int64("offset", m.Offset),
+		)
+
+		tracker.track(m)
+		c.status.fetched(m)
+
+		select {
+		case queues[c.workerFor(m, len(queues))] <- m:
+		case <-ctx.Done():
+			c.logger.Info("Context cancelled, shutting down consumer...")
+			return
+		}
+	}
+}
+
+// Выбирает воркера так, чтобы сообщения одной партиции или одного ключа
+// всегда попадали к одному и тому же воркеру
+func (c *Consumer) workerFor(m source.Message, workers int) int {
+	h := fnv.New32a()
+	if c.ordering == configs.OrderingKey && len(m.Key) > 0 {
+		h.Write(m.Key)
+	} else {
+		fmt.Fprintf(h, "%s/%d", m.Topic, m.Partition)
+	}
+	return int(h.Sum32() % uint32(workers))
+}
+
+func (c *Consumer) worker(ctx context.Context, queue <-chan source.Message, done chan<- source.Message) {
+	if c.batchSize > 1 {
+		c.batchWorker(ctx, queue, done)
+		return
+	}
+
+	for m := range queue {
+		c.handleAndAck(ctx, m, done)
+	}
+}
+
+// Накапливает до batchSize сообщений или ждет batchTimeout с момента прихода первого из них
+// и обрабатывает накопленное пачкой
+func (c *Consumer) batchWorker(ctx context.Context, queue <-chan source.Message, done chan<- source.Message) {
+	batch := make([]source.Message, 0, c.batchSize)
+	timer := time.NewTimer(c.batchTimeout)
+	timer.Stop()
+	defer timer.Stop()
+
+	flush := func() {
+		timer.Stop()
+		c.processBatch(ctx, batch, done)
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case m, ok := <-queue:
+			if !ok {
+				if len(batch) > 0 {
+					flush()
+				}
+				return
+			}
+
+			batch = append(batch, m)
+			if len(batch) == 1 {
+				timer.Reset(c.batchTimeout)
+			}
+			if len(batch) >= c.batchSize {
+				flush()
+			}
+		case <-timer.C:
+			if len(batch) > 0 {
+				flush()
+			}
+		}
+	}
+}
+
+// Подряд идущие события order.created сохраняются одной транзакцией, остальные
+// сообщения обрабатываются по одному. Исходный порядок сообщений при этом сохраняется
+func (c *Consumer) processBatch(ctx context.Context, batch []source.Message, done chan<- source.Message) {
+	var run []source.Message
+	var orders []*model.Order
+
+	for _, m := range batch {
+		// Заказы разных топиков проверяются разными наборами проверок, поэтому сохраняются отдельно
+		if len(run) > 0 && run[0].Topic != m.Topic {
+			c.saveRun(ctx, run, orders, done)
+			run, orders = nil, nil
+		}
+
+		event, _, err := c.decoder.DecodeMessage(m)
+		if err == nil && event.Type == model.EventOrderCreated && event.Order != nil && event.OrderUID == event.Order.OrderUID {
+			run = append(run, m)
+			orders = append(orders, event.Order)
+			continue
+		}
+
+		c.saveRun(ctx, run, orders, done)
+		run, orders = nil, nil
+		c.handleAndAck(ctx, m, done)
+	}
+
+	c.saveRun(ctx, run, orders, done)
+}
+
+// Сохраняет новые заказы одного топика одной транзакцией. Если пачка не сохранилась, сообщения
+// обрабатываются по одному, чтобы один плохой заказ не мешал остальным
+func (c *Consumer) saveRun(ctx context.Context, run []source.Message, orders []*model.Order, done chan<- source.Message) {
+	if len(run) == 0 || ctx.Err() != nil {
+		return
+	}
+	if len(run) == 1 {
+		c.handleAndAck(ctx, run[0], done)
+		return
+	}
+
+	topic := run[0].Topic
+	outcomes, err := c.service.SaveOrders(service.WithSourceTopic(c.withOffsets(ctx, run...), topic), orders)
+	if err != nil {
+		c.logger.Warn("Failed to save batch of orders, falling back to per-message processing",
+			zap.Error(err),
+			zap.String("topic", topic),
+			zap.Int("batch_size", len(run)),
+		)
+		for _, m := range run {
+			c.handleAndAck(ctx, m, done)
+		}
+		return
+	}
+
+	duplicates := 0
+	for i, m := range run {
+		if outcomes[i] == model.OrderDuplicate {
+			duplicates++
+			c.logger.Info("Event is already applied, skipping redelivered message",
+				zap.String("topic", topic),
+				zap.String("event_type", string(model.EventOrderCreated)),
+				zap.String("order_uid", orders[i].OrderUID),
+			)
+		}
+		done <- m
+	}
+	c.status.count(topic, func(cnt *Counters) {
+		cnt.Processed += int64(len(run))
+		cnt.Duplicates += int64(duplicates)
+	})
+	c.logger.Info("Batch of orders saved", zap.String("topic", topic), zap.Int("batch_size", len(run)))
+}
+
+// Обрабатывает одно сообщение и передает его на коммит
+func (c *Consumer) handleAndAck(ctx context.Context, m source.Message, done chan<- source.Message) {
+	// После отмены контекста оставшиеся в очереди сообщения не обрабатываются
+	// и не коммитятся, после рестарта они будут прочитаны снова
+	if err := c.handleMessage(ctx, m); err != nil {
+		c.logger.Info("Context cancelled before message was processed, offset is not committed",
+			zap.String("topic", m.Topic),
+			zap.Int("partition", m.Partition),
+			zap.Int64("offset", m.Offset),
+		)
+		return
+	}
+	done <- m
+}
+
+// Коммитит оффсеты обработанных сообщений. Коммиты идут из одной горутины,
+// чтобы более старый оффсет не перезаписал более новый. Готовые к коммиту
+// сообщения накапливаются, пока идет предыдущий коммит, и коммитятся одним запросом
+func (c *Consumer) commitLoop(tracker *offsetTracker, done <-chan source.Message) {
+	for m := range done {
+		toCommit := make(map[topicPartition]source.Message)
+		c.collectCommit(tracker, m, toCommit)
+
+	drain:
+		for {
+			select {
+			case m, ok := <-done:
+				if !ok {
+					break drain
+				}
+				c.collectCommit(tracker, m, toCommit)
+			default:
+				break drain
+			}
+		}
+
+		if len(toCommit) == 0 {
+			continue
+		}
+
+		msgs := make([]source.Message, 0, len(toCommit))
+		for _, m := range toCommit {
+			msgs = append(msgs, m)
+		}
+
+		// Обработанные сообщения коммитятся и во время остановки, поэтому контекст отдельный
+		commitCtx, cancel := context.WithTimeout(context.Background(), commitTimeout)
+		err := c.source.Commit(commitCtx, msgs...)
+		cancel()
+		if err != nil {
+			c.logger.Error("Failed to commit offsets, messages will be redelivered", zap.Error(err), zap.Int("messages", len(msgs)))
+			continue
+		}
+		c.status.committed(msgs)
+	}
+}
+
+func (c *Consumer) collectCommit(tracker *offsetTracker, m source.Message, toCommit map[topicPartition]source.Message) {
+	last, ok := tracker.markDone(m)
+	if !ok {
+		return
+	}
+	toCommit[topicPartition{topic: last.Topic, partition: last.Partition}] = last
+}
+
+// Обрабатывает сообщение, пока оно не будет сохранено или отложено в карантин.
+// Если пропустить сообщение с несохраненным заказом, следующий коммит подтвердит и его,
+// поэтому ошибка возвращается только при отмене контекста
+func (c *Consumer) handleMessage(ctx context.Context, m source.Message) error {
+	for attempt := 1; ; attempt++ {
+		err := c.processMessage(ctx, m)
+		if err == nil {
+			return nil
+		}
+
+		delay := c.retry.Delay(attempt)
+		c.logger.Error("Message was not processed, retrying without committing offset",
+			zap.Error(err),
+			zap.String("topic", m.Topic),
+			zap.Int("partition", m.Partition),
+			zap.Int64("offset", m.Offset),
+			zap.Duration("retry_in", delay),
+		)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// Возвращает nil, если сообщение можно коммитить: событие применено
+// или сообщение, которое не удалось обработать, отложено в карантин.
+// Постоянные ошибки не повторяются, временные (БД недоступна) повторяются
+// с экспоненциальной задержкой до успеха, а неизвестные - не больше maxAttempts раз
+func (c *Consumer) processMessage(ctx context.Context, m source.Message) error {
+	ctx = service.WithSourceTopic(c.withOffsets(ctx, m), m.Topic)
+
+	event, format, err := c.decoder.DecodeMessage(m)
+	if err != nil {
+		kind := FailureUnmarshal
+		if errors.Is(err, codec.ErrUnsupportedFormat) {
+			kind = FailureUnsupported
+		}
+		c.logger.Error("Failed to decode message",
+			zap.Error(err),
+			zap.String("topic", m.Topic),
+			zap.String("format", format.String()),
+			zap.ByteString("message_value", m.Value),
+		)
+		return c.quarantine(ctx, m, kind, err, 1)
+	}
+
+	fields := []zap.Field{
+		zap.String("topic", m.Topic),
+		zap.String("event_type", string(event.Type)),
+		zap.String("order_uid", event.OrderUID),
+		zap.String("format", format.String()),
+	}
+
+	attempt := 1
+	for ; ; attempt++ {
+		var outcome model.SaveOutcome
+		outcome, err = c.service.HandleEvent(ctx, event)
+		if err == nil {
+			duplicate := outcome == model.OrderDuplicate
+			if duplicate {
+				c.logger.Info("Event is already applied, skipping redelivered message", fields...)
+			}
+			c.countProcessed(m.Topic, duplicate)
+			return nil
+		}
+
+		if errors.Is(err, service.ErrAlreadyProcessed) {
+			c.logger.Info("Message offset is already stored, skipping redelivered message", append(fields, zap.Error(err))...)
+			c.countProcessed(m.Topic, true)
+			return nil
+		}
+
+		if kind, ok := permanentFailure(err); ok {
+			c.logger.Error("Order event cannot be applied", append(fields, zap.Error(err), zap.String("failure_kind", kind))...)
+			return c.quarantine(ctx, m, kind, err, attempt)
+		}
+
+		transient := errors.Is(err, service.ErrUnavailable)
+		if !transient && attempt >= c.maxAttempts {
+			break
+		}
+
+		c.status.count(m.Topic, func(cnt *Counters) { cnt.Retries++ })
+		delay := c.retry.Delay(attempt)
+		c.logger.Warn("Failed to apply order event, retrying...",
+			append(fields,
+				zap.Error(err),
+				zap.Int("attempt", attempt),
+				zap.Bool("transient", transient),
+				zap.Duration("retry_in", delay),
+			)...,
+		)
+
+		select {
+		case <-ctx.Done():
+			c.logger.Warn("Context cancelled during retry loop")
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+
+	err = fmt.Errorf("failed to apply %s event for order %s after %d attempts: %w", event.Type, event.OrderUID, attempt, err)
+	c.logger.Error("Failed to apply order event after multiple retries", append(fields, zap.Error(err))...)
+	return c.quarantine(ctx, m, FailureRetriesExhausted, err, attempt)
+}
+
+func (c *Consumer) countProcessed(topic string, duplicate bool) {
+	c.status.count(topic, func(cnt *Counters) {
+		cnt.Processed++
+		if duplicate {
+			cnt.Duplicates++
+		}
+	})
+}
+
+// Если оффсеты хранятся в БД, добавляет в контекст последние оффсеты сообщений
+// по партициям, чтобы они сохранились в одной транзакции с результатом обработки.
+// Партицию обрабатывает один воркер по порядку, поэтому все более ранние
+// сообщения партиции к этому моменту уже обработаны
+func (c *Consumer) withOffsets(ctx context.Context, msgs ...source.Message) context.Context {
+	if c.offsetGroup == "" {
+		return ctx
+	}
+
+	last := make(map[topicPartition]int64, len(msgs))
+	for _, m := range msgs {
+		tp := topicPartition{topic: m.Topic, partition: m.Partition}
+		if offset, ok := last[tp]; !ok || m.Offset > offset {
+			last[tp] = m.Offset
+		}
+	}
+
+	offsets := make([]model.SourceOffset, 0, len(last))
+	for tp, offset := range last {
+		offsets = append(offsets, model.SourceOffset{
+			Group:     c.offsetGroup,
+			Topic:     tp.topic,
+			Partition: tp.partition,
+			Offset:    offset,
+		})
+	}
+	return service.WithOffsets(ctx, offsets...)
+}
+
+// Возвращает тип ошибки для карантина, если ошибка постоянная и повтор не поможет
+func permanentFailure(err error) (string, bool) {
+	switch {
+	case errors.Is(err, service.ErrInvalidOrder):
+		return FailureValidation, true
+	case errors.Is(err, service.ErrOrderConflict):
+		return FailureConflict, true
+	case errors.Is(err, service.ErrOrderNotFound),
+		errors.Is(err, service.ErrItemNotFound),
+		errors.Is(err, service.ErrOrderCancelled):
+		return FailureNotApplicable, true
+	case errors.Is(err, service.ErrDataRejected):
+		return FailureDataRejected, true
+	}
+	return "", false
+}
+
+// Откладывает сообщение, которое не удалось обработать: публикует его в dead-letter топик,
+// если он настроен, и сохраняет в таблицу карантина. Публикация идет первой: вместе с карантином
+// может сохраниться оффсет, и если бы публикация после этого не удалась, повторно доставленное
+// сообщение считалось бы обработанным и в dead-letter топик уже не попало. Поэтому при падении
+// между шагами сообщение может быть опубликовано в dead-letter топик повторно
+func (c *Consumer) quarantine(ctx context.Context, m source.Message, kind string, cause error, attempts int) error {
+	if c.dlq != nil {
+		if err := c.dlq.Publish(ctx, m, kind, cause, attempts); err != nil {
+			c.status.count(m.Topic, func(cnt *Counters) { cnt.QuarantineErrors++ })
+			return fmt.Errorf("failed to publish message to dead-letter topic: %w", err)
+		}
+	}
+
+	// Для неизвестного формата в карантин попадает пустой content_type, формат
+	// указывается вместе с исправленным телом
+	format, _ := codec.FormatOf(m.Headers)
+	failed := &model.FailedMessage{
+		Topic:            m.Topic,
+		Partition:        m.Partition,
+		Offset:           m.Offset,
+		Payload:          m.Value,
+		ContentType:      format.ContentType,
+		SchemaVersion:    format.SchemaVersion,
+		FailureKind:      kind,
+		Error:            cause.Error(),
+		ValidationErrors: model.Violations(cause),
+		Attempts:         attempts,
+	}
+	if err := c.service.QuarantineMessage(ctx, failed); err != nil {
+		if errors.Is(err, service.ErrAlreadyProcessed) {
+			c.logger.Info("Message offset is already stored, skipping redelivered message", zap.Error(err), zap.String("topic", m.Topic))
+			c.countProcessed(m.Topic, true)
+			return nil
+		}
+		c.status.count(m.Topic, func(cnt *Counters) { cnt.QuarantineErrors++ })
+		return fmt.Errorf("failed to save message to quarantine: %w", err)
+	}
+
+	c.status.count(m.Topic, func(cnt *Counters) { cnt.Quarantined[kind]++ })
+
+	c.logger.Info("Message quarantined",
+		zap.Int64("failed_message_id", failed.ID),
+		zap.String("failure_kind", kind),
+		zap.Bool("dead_lettered", c.dlq != nil),
+		zap.String("topic", m.Topic),
+		zap.Int("partition", m.Partition),
+		zap.Int64("offset", m.Offset),
+	)
+	return nil
+}
@@ -0,0 +1,398 @@
+package consumer_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"orders-service/internal/app/model"
+	"orders-service/internal/app/service"
+	"orders-service/internal/app/service/servicetest"
+	"orders-service/internal/codec"
+	"orders-service/internal/configs"
+	"orders-service/internal/consumer"
+	"orders-service/internal/source"
+	"orders-service/internal/source/memory"
+
+	"go.uber.org/zap"
+)
+
+var errCrashed = errors.New("process crashed before commit")
+
+// Партиция брокера: сообщения и закоммиченный оффсет переживают перезапуск консьюмера
+type partitionLog struct {
+	mu        sync.Mutex
+	msgs      []source.Message
+	committed int64
+	// Оффсеты, которые прочитал каждый запуск
+	deliveries [][]int64
+}
+
+func newPartitionLog(t *testing.T, uids ...string) *partitionLog {
+	t.Helper()
+
+	log := &partitionLog{committed: -1}
+	for _, uid := range uids {
+		log.addOrder(t, servicetest.NewOrder(uid))
+	}
+	return log
+}
+
+func (l *partitionLog) addOrder(t *testing.T, order *model.Order) {
+	t.Helper()
+
+	value, err := json.Marshal(order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.msgs = append(l.msgs, source.Message{Topic: "orders", Offset: int64(len(l.msgs)), Key: []byte(order.OrderUID), Value: value})
+}
+
+// Добавляет в конец партиции сообщение с произвольным телом
+func (l *partitionLog) add(value []byte) {
+	l.msgs = append(l.msgs, source.Message{Topic: "orders", Offset: int64(len(l.msgs)), Value: value})
+}
+
+func (l *partitionLog) Committed() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.committed
+}
+
+// Подключение к партиции одного запуска консьюмера. Читает с оффсета после закоммиченного,
+// а если crash задан, процесс падает на первом коммите: оффсет не сохраняется, запуск останавливается
+type logSource struct {
+	log   *partitionLog
+	run   int
+	next  int64
+	crash context.CancelFunc
+}
+
+func (l *partitionLog) connect(crash context.CancelFunc) *logSource {
+	return l.connectAt(l.Committed()+1, crash)
+}
+
+func (l *partitionLog) connectAt(next int64, crash context.CancelFunc) *logSource {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.deliveries = append(l.deliveries, nil)
+	return &logSource{log: l, run: len(l.deliveries) - 1, next: next, crash: crash}
+}
+
+func (s *logSource) Fetch(ctx context.Context) (source.Message, error) {
+	s.log.mu.Lock()
+	defer s.log.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return source.Message{}, err
+	}
+	if s.next >= int64(len(s.log.msgs)) {
+		return source.Message{}, source.ErrExhausted
+	}
+
+	m := s.log.msgs[s.next]
+	s.next++
+	s.log.deliveries[s.run] = append(s.log.deliveries[s.run], m.Offset)
+	return m, nil
+}
+
+func (s *logSource) Commit(_ context.Context, msgs ...source.Message) error {
+	if s.crash != nil {
+		s.crash()
+		return errCrashed
+	}
+
+	s.log.mu.Lock()
+	defer s.log.mu.Unlock()
+	for _, m := range msgs {
+		s.log.committed = max(s.log.committed, m.Offset)
+	}
+	return nil
+}
+
+func (s *logSource) Close() error {
+	return nil
+}
+
+// Сервис, который не может сохранить заказ blocked, пока БД для него "недоступна"
+type gatedService struct {
+	consumer.OrderService
+	blocked string
+
+	mu       sync.Mutex
+	released bool
+}
+
+func (s *gatedService) HandleEvent(ctx context.Context, event *model.OrderEvent) (model.SaveOutcome, error) {
+	s.mu.Lock()
+	blocked := !s.released && event.OrderUID == s.blocked
+	s.mu.Unlock()
+	if blocked {
+		return 0, fmt.Errorf("%w: connection refused", service.ErrUnavailable)
+	}
+	return s.OrderService.HandleEvent(ctx, event)
+}
+
+func (s *gatedService) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.released = true
+}
+
+func newOrderService(t *testing.T, repo *servicetest.Repository) *service.OrderService {
+	t.Helper()
+	return service.NewOrderService(repo, servicetest.NewCache(), newDecoder(t), service.Validation{}, zap.NewNop())
+}
+
+func newDecoder(t *testing.T) *codec.Registry {
+	t.Helper()
+
+	decoder, err := codec.NewRegistry("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return decoder
+}
+
+func newConsumer(t *testing.T, src source.OrderSource, svc consumer.OrderService, dlq consumer.DeadLetterPublisher) *consumer.Consumer {
+	t.Helper()
+	return newConsumerWithConfig(t, consumerConfig(), src, svc, dlq)
+}
+
+func consumerConfig() configs.Consumer {
+	return configs.Consumer{
+		Workers:             4,
+		Ordering:            configs.OrderingKey,
+		BatchSize:           1,
+		RetryInitialBackoff: time.Millisecond,
+		RetryMaxBackoff:     time.Millisecond,
+		RetryMaxAttempts:    3,
+	}
+}
+
+func newConsumerWithConfig(t *testing.T, cfg configs.Consumer, src source.OrderSource, svc consumer.OrderService, dlq consumer.DeadLetterPublisher) *consumer.Consumer {
+	t.Helper()
+
+	c, err := consumer.NewConsumer(cfg, src, newDecoder(t), dlq, svc, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// Запускает консьюмер и ждет его остановки
+func run(t *testing.T, ctx context.Context, c *consumer.Consumer) {
+	t.Helper()
+
+	done := make(chan struct{})
+	go func() {
+		c.Start(ctx)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("consumer did not stop")
+	}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCrashBeforeCommitRedeliversMessages(t *testing.T) {
+	repo := servicetest.NewRepository()
+	svc := newOrderService(t, repo)
+	log := newPartitionLog(t, "order-0", "order-1", "order-2", "order-3")
+
+	ctx, crash := context.WithCancel(context.Background())
+	defer crash()
+	run(t, ctx, newConsumer(t, log.connect(crash), svc, nil))
+
+	if log.Committed() != -1 {
+		t.Fatalf("committed offset = %d after crash, want nothing committed", log.Committed())
+	}
+	saved := len(repo.Orders())
+
+	restarted := newConsumer(t, log.connect(nil), svc, nil)
+	run(t, context.Background(), restarted)
+
+	// Все сообщения, которые не успели закоммитить, читаются заново, а уже
+	// сохраненные заказы считаются дубликатами и не сохраняются повторно
+	if redelivered := log.deliveries[1]; len(redelivered) != 4 || redelivered[0] != 0 {
+		t.Errorf("restart read offsets %v, want all messages from 0", redelivered)
+	}
+	if log.Committed() != 3 {
+		t.Errorf("committed offset = %d, want 3", log.Committed())
+	}
+	if len(repo.Orders()) != 4 {
+		t.Errorf("stored %d orders, want 4", len(repo.Orders()))
+	}
+	if status := restarted.Status(); status.Counters.Duplicates != int64(saved) {
+		t.Errorf("duplicates = %d, want %d orders saved before crash", status.Counters.Duplicates, saved)
+	}
+}
+
+func TestCommitDoesNotPassUnsavedMessage(t *testing.T) {
+	repo := servicetest.NewRepository()
+	uids := make([]string, 10)
+	for i := range uids {
+		uids[i] = fmt.Sprintf("order-%d", i)
+	}
+	log := newPartitionLog(t, uids...)
+	svc := &gatedService{OrderService: newOrderService(t, repo), blocked: "order-3"}
+
+	// Сообщения с разными ключами обрабатываются параллельно, поэтому более поздние
+	// сохраняются раньше order-3, который ждет БД
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	c := newConsumer(t, log.connect(nil), svc, nil)
+	done := make(chan struct{})
+	go func() {
+		c.Start(ctx)
+		close(done)
+	}()
+
+	waitFor(t, "an order after order-3 to be saved", func() bool {
+		for _, order := range repo.Orders() {
+			if order.OrderUID > "order-3" {
+				return true
+			}
+		}
+		return false
+	})
+	waitFor(t, "offsets before order-3 to be committed", func() bool { return log.Committed() == 2 })
+	for range 20 {
+		if log.Committed() != 2 {
+			t.Fatalf("committed offset = %d while order-3 at offset 3 is not saved, want 2", log.Committed())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Процесс останавливается, так и не сохранив order-3
+	stop()
+	<-done
+	if log.Committed() != 2 {
+		t.Fatalf("committed offset = %d after stop, want 2", log.Committed())
+	}
+
+	svc.release()
+	run(t, context.Background(), newConsumer(t, log.connect(nil), svc, nil))
+
+	if redelivered := log.deliveries[1]; len(redelivered) != 7 || redelivered[0] != 3 {
+		t.Errorf("restart read offsets %v, want 3..9", redelivered)
+	}
+	if log.Committed() != 9 || len(repo.Orders()) != 10 {
+		t.Errorf("committed offset = %d, stored %d orders, want 9 and 10", log.Committed(), len(repo.Orders()))
+	}
+}
+
+func TestConsumeMemorySource(t *testing.T) {
+	repo := servicetest.NewRepository()
+
+	values := make(chan []byte, 3)
+	for _, uid := range []string{"order-1", "order-2"} {
+		value, err := json.Marshal(servicetest.NewOrder(uid))
+		if err != nil {
+			t.Fatal(err)
+		}
+		values <- value
+	}
+	values <- []byte(`{"order_uid": "broken"`)
+	close(values)
+
+	src := memory.New("orders", values)
+	c := newConsumer(t, src, newOrderService(t, repo), nil)
+	run(t, context.Background(), c)
+
+	// Невалидное сообщение отложено в карантин, поэтому его оффсет тоже закоммичен
+	if src.Committed() != 2 {
+		t.Errorf("committed offset = %d, want 2", src.Committed())
+	}
+	if len(repo.Orders()) != 2 {
+		t.Errorf("stored %d orders, want 2", len(repo.Orders()))
+	}
+	failed, err := repo.ListFailedMessages(context.Background(), model.FailedMessagePending, 10, 0)
+	if err != nil || len(failed) != 1 || failed[0].FailureKind != consumer.FailureUnmarshal || failed[0].Offset != 2 {
+		t.Errorf("failed messages = %+v, %v", failed, err)
+	}
+}
+
+// Сервис, в котором сохранение пачки заказов всегда завершается ошибкой
+type failingBatchService struct {
+	consumer.OrderService
+
+	mu      sync.Mutex
+	batches int
+}
+
+func (s *failingBatchService) SaveOrders(context.Context, []*model.Order) ([]model.SaveOutcome, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batches++
+	return nil, errors.New("deadlock detected")
+}
+
+func TestFailedBatchFallsBackToSingleMessages(t *testing.T) {
+	cfg := consumerConfig()
+	cfg.Ordering = configs.OrderingPartition
+	cfg.BatchSize = 10
+	cfg.BatchTimeout = time.Second
+
+	t.Run("invalid order", func(t *testing.T) {
+		repo := servicetest.NewRepository()
+		log := newPartitionLog(t, "order-0", "order-1")
+		invalid := servicetest.NewOrder("order-2")
+		invalid.TrackNumber = ""
+		log.addOrder(t, invalid)
+		log.addOrder(t, servicetest.NewOrder("order-3"))
+
+		c := newConsumerWithConfig(t, cfg, log.connect(nil), newOrderService(t, repo), nil)
+		run(t, context.Background(), c)
+
+		// Один невалидный заказ не мешает сохранить остальные заказы пачки
+		if len(repo.Orders()) != 3 {
+			t.Errorf("stored %d orders, want 3", len(repo.Orders()))
+		}
+		failed, err := repo.ListFailedMessages(context.Background(), model.FailedMessagePending, 10, 0)
+		if err != nil || len(failed) != 1 || failed[0].Offset != 2 || failed[0].FailureKind != consumer.FailureValidation {
+			t.Errorf("failed messages = %+v, %v, want validation failure at offset 2", failed, err)
+		}
+		if log.Committed() != 3 {
+			t.Errorf("committed offset = %d, want 3", log.Committed())
+		}
+	})
+
+	t.Run("repository error", func(t *testing.T) {
+		repo := servicetest.NewRepository()
+		log := newPartitionLog(t, "order-0", "order-1", "order-2")
+		svc := &failingBatchService{OrderService: newOrderService(t, repo)}
+
+		c := newConsumerWithConfig(t, cfg, log.connect(nil), svc, nil)
+		run(t, context.Background(), c)
+
+		if svc.batches != 1 {
+			t.Errorf("SaveOrders called %d times, want 1", svc.batches)
+		}
+		if len(repo.Orders()) != 3 || log.Committed() != 2 {
+			t.Errorf("stored %d orders, committed offset %d, want 3 and 2", len(repo.Orders()), log.Committed())
+		}
+		if status := c.Status(); status.Counters.Processed != 3 {
+			t.Errorf("processed = %d, want 3", status.Counters.Processed)
+		}
+	})
+}
@@ -0,0 +1,70 @@
+package consumer
+
+import (
+	"sync"
+
+	"orders-service/internal/source"
+)
+
+type topicPartition struct {
+	topic     string
+	partition int
+}
+
+// Очередь прочитанных, но еще не закоммиченных сообщений одной партиции
+type partitionOffsets struct {
+	pending []source.Message
+	done    map[int64]bool
+}
+
+// Отслеживает сообщения, которые обрабатываются параллельно. Коммитить можно только
+// оффсет, до которого включительно обработаны все прочитанные сообщения партиции,
+// иначе после рестарта необработанные сообщения будут пропущены
+type offsetTracker struct {
+	mu         sync.Mutex
+	partitions map[topicPartition]*partitionOffsets
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{partitions: make(map[topicPartition]*partitionOffsets)}
+}
+
+// Запоминает прочитанное сообщение. Вызывается в порядке чтения
+func (t *offsetTracker) track(m source.Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := topicPartition{topic: m.Topic, partition: m.Partition}
+	p, ok := t.partitions[key]
+	// Оффсет не больше уже прочитанного означает, что после ребаланса партиция
+	// читается заново с последнего коммита, и старая очередь больше не нужна
+	if !ok || (len(p.pending) > 0 && m.Offset <= p.pending[len(p.pending)-1].Offset) {
+		p = &partitionOffsets{done: make(map[int64]bool)}
+		t.partitions[key] = p
+	}
+	p.pending = append(p.pending, m)
+}
+
+// Отмечает сообщение обработанным и возвращает последнее сообщение партиции,
+// до которого включительно все сообщения обработаны. false означает, что коммитить пока нечего
+func (t *offsetTracker) markDone(m source.Message) (source.Message, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.partitions[topicPartition{topic: m.Topic, partition: m.Partition}]
+	if !ok {
+		return source.Message{}, false
+	}
+	p.done[m.Offset] = true
+
+	var last source.Message
+	advanced := false
+	for len(p.pending) > 0 && p.done[p.pending[0].Offset] {
+		last = p.pending[0]
+		delete(p.done, last.Offset)
+		p.pending = p.pending[1:]
+		advanced = true
+	}
+
+	return last, advanced
+}
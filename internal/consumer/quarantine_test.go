@@ -0,0 +1,229 @@
+package consumer_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+
+	"orders-service/internal/app/model"
+	"orders-service/internal/app/service/servicetest"
+	"orders-service/internal/configs"
+	"orders-service/internal/consumer"
+	"orders-service/internal/source"
+)
+
+const offsetGroup = "orders-service"
+
+// Dead-letter топик, который запоминает оффсеты опубликованных сообщений.
+// Первые fail публикаций завершаются ошибкой, а если задан crash, процесс падает на публикации
+type deadLetters struct {
+	mu        sync.Mutex
+	fail      int
+	crash     context.CancelFunc
+	published []int64
+}
+
+func (d *deadLetters) Publish(_ context.Context, m source.Message, _ string, _ error, _ int) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.crash != nil {
+		d.crash()
+		return errCrashed
+	}
+	if d.fail > 0 {
+		d.fail--
+		return errors.New("broker is not available")
+	}
+	d.published = append(d.published, m.Offset)
+	return nil
+}
+
+func (d *deadLetters) Published() []int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return slices.Clone(d.published)
+}
+
+func (d *deadLetters) Close() error {
+	return nil
+}
+
+// Сервис, процесс которого падает до или после сохранения сообщения в карантин
+type crashingQuarantine struct {
+	consumer.OrderService
+	crash context.CancelFunc
+	// Падение после того, как карантин и оффсет сохранены
+	afterStore bool
+}
+
+func (s *crashingQuarantine) QuarantineMessage(ctx context.Context, msg *model.FailedMessage) error {
+	if s.afterStore {
+		if err := s.OrderService.QuarantineMessage(ctx, msg); err != nil {
+			return err
+		}
+	}
+	s.crash()
+	return errCrashed
+}
+
+// Источник с оффсетами в хранилище, как kafka.GroupSource: в брокер оффсеты не коммитятся
+type storedSource struct {
+	*logSource
+}
+
+func (s storedSource) Commit(context.Context, ...source.Message) error {
+	return nil
+}
+
+// Подключается к партиции с оффсета, сохраненного в repo, или с начала, если его нет
+func connectStored(log *partitionLog, repo *servicetest.Repository) storedSource {
+	next, _ := repo.Offset(offsetGroup, "orders", 0)
+	return storedSource{log.connectAt(next, nil)}
+}
+
+func offsetsConfig() configs.Consumer {
+	cfg := consumerConfig()
+	cfg.Ordering = configs.OrderingPartition
+	cfg.OffsetGroup = offsetGroup
+	return cfg
+}
+
+// Два заказа и невалидное сообщение с оффсетом 2
+func newQuarantineLog(t *testing.T) *partitionLog {
+	t.Helper()
+
+	log := newPartitionLog(t, "order-0", "order-1")
+	log.add([]byte(`{"order_uid": "broken"`))
+	return log
+}
+
+func checkQuarantined(t *testing.T, repo *servicetest.Repository) {
+	t.Helper()
+
+	failed, err := repo.ListFailedMessages(context.Background(), model.FailedMessagePending, 10, 0)
+	if err != nil || len(failed) != 1 || failed[0].Offset != 2 {
+		t.Errorf("failed messages = %+v, %v, want one message at offset 2", failed, err)
+	}
+	if next, ok := repo.Offset(offsetGroup, "orders", 0); !ok || next != 3 {
+		t.Errorf("stored offset = %d, %t, want 3", next, ok)
+	}
+}
+
+func TestCrashWhileQuarantiningKeepsDeadLetter(t *testing.T) {
+	tests := []struct {
+		name string
+		// Запускает первый процесс, который падает на шаге
+		crash func(t *testing.T, log *partitionLog, repo *servicetest.Repository, dlq *deadLetters)
+		// Оффсет, сохраненный к моменту падения
+		stored int64
+		// Сколько раз сообщение опубликовано в dead-letter топик после перезапуска
+		published int
+	}{
+		{
+			name: "before dead-letter publish",
+			crash: func(t *testing.T, log *partitionLog, repo *servicetest.Repository, dlq *deadLetters) {
+				ctx, crash := context.WithCancel(context.Background())
+				defer crash()
+				dlq.crash = crash
+				defer func() { dlq.crash = nil }()
+				run(t, ctx, newConsumerWithConfig(t, offsetsConfig(), connectStored(log, repo), newOrderService(t, repo), dlq))
+			},
+			stored:    2,
+			published: 1,
+		},
+		{
+			name: "after dead-letter publish",
+			crash: func(t *testing.T, log *partitionLog, repo *servicetest.Repository, dlq *deadLetters) {
+				ctx, crash := context.WithCancel(context.Background())
+				defer crash()
+				svc := &crashingQuarantine{OrderService: newOrderService(t, repo), crash: crash}
+				run(t, ctx, newConsumerWithConfig(t, offsetsConfig(), connectStored(log, repo), svc, dlq))
+			},
+			stored:    2,
+			published: 2,
+		},
+		{
+			name: "after quarantine is stored",
+			crash: func(t *testing.T, log *partitionLog, repo *servicetest.Repository, dlq *deadLetters) {
+				ctx, crash := context.WithCancel(context.Background())
+				defer crash()
+				svc := &crashingQuarantine{OrderService: newOrderService(t, repo), crash: crash, afterStore: true}
+				run(t, ctx, newConsumerWithConfig(t, offsetsConfig(), connectStored(log, repo), svc, dlq))
+			},
+			stored:    3,
+			published: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := servicetest.NewRepository()
+			log := newQuarantineLog(t)
+			dlq := &deadLetters{}
+
+			tt.crash(t, log, repo, dlq)
+			if next, _ := repo.Offset(offsetGroup, "orders", 0); next != tt.stored {
+				t.Fatalf("stored offset = %d after crash, want %d", next, tt.stored)
+			}
+
+			// Перезапуск читает партицию с сохраненного оффсета
+			run(t, context.Background(), newConsumerWithConfig(t, offsetsConfig(), connectStored(log, repo), newOrderService(t, repo), dlq))
+
+			checkQuarantined(t, repo)
+			if published := dlq.Published(); len(published) != tt.published || published[0] != 2 {
+				t.Errorf("dead-letter offsets = %v, want offset 2 published %d times", published, tt.published)
+			}
+			if len(repo.Orders()) != 2 {
+				t.Errorf("stored %d orders, want 2", len(repo.Orders()))
+			}
+		})
+	}
+}
+
+func TestDeadLetterPublishFailureRetriesMessage(t *testing.T) {
+	repo := servicetest.NewRepository()
+	log := newQuarantineLog(t)
+	dlq := &deadLetters{fail: 2}
+
+	c := newConsumerWithConfig(t, offsetsConfig(), connectStored(log, repo), newOrderService(t, repo), dlq)
+	run(t, context.Background(), c)
+
+	// Пока публикация не прошла, оффсет не сохраняется, и сообщение обрабатывается заново
+	checkQuarantined(t, repo)
+	if published := dlq.Published(); len(published) != 1 || published[0] != 2 {
+		t.Errorf("dead-letter offsets = %v, want [2]", published)
+	}
+	if status := c.Status(); status.Counters.QuarantineErrors != 2 {
+		t.Errorf("quarantine errors = %d, want 2", status.Counters.QuarantineErrors)
+	}
+}
+
+func TestStoredOffsetSkipsRedeliveredMessages(t *testing.T) {
+	repo := servicetest.NewRepository()
+	log := newQuarantineLog(t)
+	dlq := &deadLetters{}
+
+	run(t, context.Background(), newConsumerWithConfig(t, offsetsConfig(), connectStored(log, repo), newOrderService(t, repo), dlq))
+	checkQuarantined(t, repo)
+
+	// После ребаланса партицию заново читает консьюмер, который начал с оффсета группы в брокере.
+	// Сохраненный оффсет не дает применить события и отложить сообщение повторно
+	redelivered := newConsumerWithConfig(t, offsetsConfig(), storedSource{log.connectAt(0, nil)}, newOrderService(t, repo), dlq)
+	run(t, context.Background(), redelivered)
+
+	checkQuarantined(t, repo)
+	if status := redelivered.Status(); status.Counters.Duplicates != 3 || status.Counters.QuarantineErrors != 0 {
+		t.Errorf("duplicates = %d, quarantine errors = %d, want 3 and 0", status.Counters.Duplicates, status.Counters.QuarantineErrors)
+	}
+	failed, err := repo.ListFailedMessages(context.Background(), model.FailedMessagePending, 10, 0)
+	if err == nil && len(failed) == 1 && failed[0].Attempts != 1 {
+		t.Errorf("quarantined message attempts = %d after redelivery, want 1", failed[0].Attempts)
+	}
+	// Dead-letter топик получает сообщения не реже одного раза, повторная доставка публикует его снова
+	if published := dlq.Published(); len(published) != 2 {
+		t.Errorf("dead-letter offsets = %v, want offset 2 published twice", published)
+	}
+}
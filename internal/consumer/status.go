@@ -0,0 +1,238 @@
+package consumer
+
+import (
+	"cmp"
+	"context"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"orders-service/internal/source"
+)
+
+// Приостанавливает чтение из источника. Пока консьюмер на паузе, Fetch не вызывается,
+// но источник не закрывается: читатель Kafka остается в группе и продолжает
+// отправлять heartbeat, поэтому ребаланса нет и партиции остаются за экземпляром
+type pauser struct {
+	mu       sync.Mutex
+	paused   bool
+	pausedAt time.Time
+	// Закрывается при снятии с паузы
+	resumed chan struct{}
+	// Контекст чтения, который отменяется при постановке на паузу
+	fetchCtx    context.Context
+	cancelFetch context.CancelFunc
+}
+
+func (p *pauser) pause() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.paused {
+		return false
+	}
+	p.paused = true
+	p.pausedAt = time.Now()
+	p.resumed = make(chan struct{})
+	if p.cancelFetch != nil {
+		p.cancelFetch()
+		p.fetchCtx, p.cancelFetch = nil, nil
+	}
+	return true
+}
+
+func (p *pauser) resume() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.paused {
+		return false
+	}
+	p.paused = false
+	p.pausedAt = time.Time{}
+	close(p.resumed)
+	return true
+}
+
+// Ждет снятия с паузы и возвращает контекст для чтения, который отменится при
+// следующей постановке на паузу. false означает, что отменен сам ctx
+func (p *pauser) wait(ctx context.Context) (context.Context, bool) {
+	for {
+		p.mu.Lock()
+		if !p.paused {
+			if p.fetchCtx == nil {
+				p.fetchCtx, p.cancelFetch = context.WithCancel(ctx)
+			}
+			fetchCtx := p.fetchCtx
+			p.mu.Unlock()
+			return fetchCtx, true
+		}
+		resumed := p.resumed
+		p.mu.Unlock()
+
+		select {
+		case <-resumed:
+		case <-ctx.Done():
+			return nil, false
+		}
+	}
+}
+
+func (p *pauser) state() (bool, time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.paused, p.pausedAt
+}
+
+// Состояние чтения одной партиции
+type PartitionStatus struct {
+	Topic     string `json:"topic"`
+	Partition int    `json:"partition"`
+	// Оффсет последнего прочитанного сообщения
+	FetchedOffset int64 `json:"fetched_offset"`
+	// Оффсет последнего закоммиченного сообщения, -1 - коммитов еще не было
+	CommittedOffset int64 `json:"committed_offset"`
+	HighWaterMark   int64 `json:"high_water_mark,omitempty"`
+	// Сообщения партиции после последнего закоммиченного. Источники без
+	// high water mark (spool) отставание не сообщают
+	Lag             *int64    `json:"lag,omitempty"`
+	LastMessageTime time.Time `json:"last_message_time"`
+}
+
+// Счетчики результатов обработки сообщений
+type Counters struct {
+	Processed int64 `json:"processed"`
+	// Повторно доставленные сообщения, которые уже были применены
+	Duplicates int64 `json:"duplicates"`
+	// Неудачные попытки применить событие, после которых оно было повторено
+	Retries int64 `json:"retries"`
+	// Сообщения, отложенные в карантин, по типу ошибки
+	Quarantined map[string]int64 `json:"quarantined"`
+	// Сообщения, которые не удалось отложить в карантин и которые обрабатываются заново
+	QuarantineErrors int64 `json:"quarantine_errors"`
+}
+
+func (c *Counters) add(other *Counters) {
+	c.Processed += other.Processed
+	c.Duplicates += other.Duplicates
+	c.Retries += other.Retries
+	c.QuarantineErrors += other.QuarantineErrors
+	for kind, n := range other.Quarantined {
+		c.Quarantined[kind] += n
+	}
+}
+
+type Status struct {
+	Paused      bool              `json:"paused"`
+	PausedAt    *time.Time        `json:"paused_at,omitempty"`
+	Partitions  []PartitionStatus `json:"partitions"`
+	FetchErrors int64             `json:"fetch_errors"`
+	// Счетчики по всем топикам и по каждому топику отдельно
+	Counters Counters            `json:"counters"`
+	Topics   map[string]Counters `json:"topics"`
+}
+
+// Собирает состояние партиций и счетчики для Status
+type statusTracker struct {
+	mu          sync.Mutex
+	partitions  map[topicPartition]*PartitionStatus
+	topics      map[string]*Counters
+	fetchErrors int64
+}
+
+func newStatusTracker() *statusTracker {
+	return &statusTracker{
+		partitions: make(map[topicPartition]*PartitionStatus),
+		topics:     make(map[string]*Counters),
+	}
+}
+
+func newCounters() *Counters {
+	return &Counters{Quarantined: make(map[string]int64)}
+}
+
+func (t *statusTracker) fetched(m source.Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := topicPartition{topic: m.Topic, partition: m.Partition}
+	p, ok := t.partitions[key]
+	if !ok {
+		p = &PartitionStatus{Topic: m.Topic, Partition: m.Partition, CommittedOffset: -1}
+		t.partitions[key] = p
+	}
+	p.FetchedOffset = m.Offset
+	p.HighWaterMark = m.HighWaterMark
+	p.LastMessageTime = m.Time
+}
+
+func (t *statusTracker) committed(msgs []source.Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, m := range msgs {
+		if p, ok := t.partitions[topicPartition{topic: m.Topic, partition: m.Partition}]; ok {
+			p.CommittedOffset = m.Offset
+		}
+	}
+}
+
+func (t *statusTracker) fetchFailed() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.fetchErrors++
+}
+
+// Изменяет счетчики топика
+func (t *statusTracker) count(topic string, fn func(c *Counters)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	counters, ok := t.topics[topic]
+	if !ok {
+		counters = newCounters()
+		t.topics[topic] = counters
+	}
+	fn(counters)
+}
+
+func (t *statusTracker) snapshot() Status {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	partitions := make([]PartitionStatus, 0, len(t.partitions))
+	for _, p := range t.partitions {
+		status := *p
+		if status.HighWaterMark > 0 {
+			// До первого коммита отставание считается от последнего прочитанного сообщения
+			next := status.CommittedOffset + 1
+			if status.CommittedOffset < 0 {
+				next = status.FetchedOffset
+			}
+			lag := max(status.HighWaterMark-next, 0)
+			status.Lag = &lag
+		}
+		partitions = append(partitions, status)
+	}
+	slices.SortFunc(partitions, func(a, b PartitionStatus) int {
+		return cmp.Or(strings.Compare(a.Topic, b.Topic), cmp.Compare(a.Partition, b.Partition))
+	})
+
+	status := Status{
+		Partitions:  partitions,
+		FetchErrors: t.fetchErrors,
+		Counters:    *newCounters(),
+		Topics:      make(map[string]Counters, len(t.topics)),
+	}
+	for topic, counters := range t.topics {
+		status.Counters.add(counters)
+
+		copied := *counters
+		copied.Quarantined = maps.Clone(counters.Quarantined)
+		status.Topics[topic] = copied
+	}
+
+	return status
+}
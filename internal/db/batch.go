@@ -0,0 +1,122 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"orders-service/internal/app/model"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Сохраняет несколько заказов одной транзакцией: заказы вставляются одним pgx.Batch,
+// а доставки, оплаты и товары новых заказов - через COPY. Результаты возвращаются
+// в порядке заказов. Если хотя бы один заказ конфликтует с сохраненным,
+// транзакция откатывается целиком, и возвращается model.ErrOrderConflict
+func (db *DB) SaveOrders(ctx context.Context, orders []*model.Order) (_ []model.SaveOutcome, err error) {
+	defer classifyErr(&err)
+	hashes := make([]string, len(orders))
+	for i, order := range orders {
+		hash, err := model.OrderHash(order)
+		if err != nil {
+			return nil, err
+		}
+		hashes[i] = hash
+	}
+
+	tx, err := db.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	batch := &pgx.Batch{}
+	for i, order := range orders {
+		batch.Queue(
+			`INSERT INTO orders (order_uid, track_number, entry, locale, internal_signature, customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard, payload_hash)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+			ON CONFLICT (order_uid) DO NOTHING`,
+			order.OrderUID, order.TrackNumber, order.Entry, order.Locale, order.InternalSignature, order.CustomerID, order.DeliveryService,
+			order.Shardkey, order.SmID, order.DateCreated, order.OofShard, hashes[i])
+	}
+
+	outcomes := make([]model.SaveOutcome, len(orders))
+	results := tx.SendBatch(ctx, batch)
+	for i := range orders {
+		tag, err := results.Exec()
+		if err != nil {
+			results.Close()
+			return nil, fmt.Errorf("failed to insert into orders: %w", err)
+		}
+		if tag.RowsAffected() > 0 {
+			outcomes[i] = model.OrderInserted
+		}
+	}
+	if err := results.Close(); err != nil {
+		return nil, fmt.Errorf("failed to insert into orders: %w", err)
+	}
+
+	var inserted []*model.Order
+	var deliveries, payments, items [][]interface{}
+	for i, order := range orders {
+		if outcomes[i] != model.OrderInserted {
+			outcome, err := db.compareWithStored(ctx, tx, order, hashes[i])
+			if err != nil {
+				return nil, err
+			}
+			outcomes[i] = outcome
+			continue
+		}
+
+		inserted = append(inserted, order)
+
+		d := order.Delivery
+		deliveries = append(deliveries, []interface{}{order.OrderUID, d.Name, d.Phone, d.Zip, d.City, d.Address, d.Region, d.Email})
+
+		p := order.Payment
+		payments = append(payments, []interface{}{order.OrderUID, p.Transaction, p.RequestID, p.Currency, p.Provider,
+			p.Amount, p.PaymentDt, p.Bank, p.DeliveryCost, p.GoodsTotal, p.CustomFee})
+
+		for _, item := range order.Items {
+			items = append(items, []interface{}{item.ChrtID, item.TrackNumber, item.Price, item.Rid, item.Name, item.Sale, item.Size,
+				item.TotalPrice, item.NmID, item.Brand, item.Status, order.OrderUID})
+		}
+	}
+
+	if err := copyRows(ctx, tx, "deliveries",
+		[]string{"order_uid", "name", "phone", "zip", "city", "address", "region", "email"}, deliveries); err != nil {
+		return nil, err
+	}
+
+	if err := copyRows(ctx, tx, "payments",
+		[]string{"order_uid", "transaction", "request_id", "currency", "provider", "amount", "payment_dt", "bank", "delivery_cost", "goods_total", "custom_fee"}, payments); err != nil {
+		return nil, err
+	}
+
+	if err := copyRows(ctx, tx, "items",
+		[]string{"chrt_id", "track_number", "price", "rid", "name", "sale", "size", "total_price", "nm_id", "brand", "status", "order_uid"}, items); err != nil {
+		return nil, err
+	}
+
+	if err := db.insertOutboxEvents(ctx, tx, inserted); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return outcomes, nil
+}
+
+func copyRows(ctx context.Context, tx pgx.Tx, table string, columns []string, rows [][]interface{}) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{table}, columns, pgx.CopyFromRows(rows)); err != nil {
+		return fmt.Errorf("failed to copy into %s: %w", table, err)
+	}
+
+	return nil
+}
@@ -2,17 +2,20 @@ package db
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
 	"orders-service/internal/app/model"
 	"orders-service/internal/configs"
 
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 )
 
 type DB struct {
-	pool *pgxpool.Pool
+	pool   *pgxpool.Pool
+	outbox bool
 }
 
 func NewDB(connStr string) (*DB, error) {
@@ -49,20 +52,40 @@ func (db *DB) Close() {
 	db.pool.Close()
 }
 
-func (db *DB) SaveOrder(ctx context.Context, order *model.Order) error {
-	tx, err := db.pool.Begin(ctx)
+// Сохраняет заказ идемпотентно: повторное сохранение того же заказа возвращает OrderDuplicate,
+// а заказ с тем же order_uid, но другим содержимым - model.ErrOrderConflict
+func (db *DB) SaveOrder(ctx context.Context, order *model.Order) (_ model.SaveOutcome, err error) {
+	defer classifyErr(&err)
+	hash, err := model.OrderHash(order)
 	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
+		return 0, err
+	}
+
+	tx, err := db.begin(ctx)
+	if err != nil {
+		return 0, err
 	}
 	defer tx.Rollback(ctx)
 
-	_, err = tx.Exec(ctx,
-		`INSERT INTO orders (order_uid, track_number, entry, locale, internal_signature, customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard) 
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+	tag, err := tx.Exec(ctx,
+		`INSERT INTO orders (order_uid, track_number, entry, locale, internal_signature, customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard, payload_hash) 
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		ON CONFLICT (order_uid) DO NOTHING`,
 		order.OrderUID, order.TrackNumber, order.Entry, order.Locale, order.InternalSignature, order.CustomerID, order.DeliveryService,
-		order.Shardkey, order.SmID, order.DateCreated, order.OofShard)
+		order.Shardkey, order.SmID, order.DateCreated, order.OofShard, hash)
 	if err != nil {
-		return fmt.Errorf("failed to insert into orders: %w", err)
+		return 0, fmt.Errorf("failed to insert into orders: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		outcome, err := db.compareWithStored(ctx, tx, order, hash)
+		if err != nil {
+			return 0, err
+		}
+		// Транзакция фиксируется и для повторно доставленного заказа, чтобы сохранить оффсет сообщения
+		if err := tx.Commit(ctx); err != nil {
+			return 0, fmt.Errorf("failed to commit transaction: %w", err)
+		}
+		return outcome, nil
 	}
 
 	_, err = tx.Exec(ctx,
@@ -71,7 +94,7 @@ func (db *DB) SaveOrder(ctx context.Context, order *model.Order) error {
 		order.OrderUID, order.Delivery.Name, order.Delivery.Phone, order.Delivery.Zip, order.Delivery.City,
 		order.Delivery.Address, order.Delivery.Region, order.Delivery.Email)
 	if err != nil {
-		return fmt.Errorf("failed to insert into deliveries: %w", err)
+		return 0, fmt.Errorf("failed to insert into deliveries: %w", err)
 	}
 
 	_, err = tx.Exec(ctx,
@@ -80,7 +103,7 @@ func (db *DB) SaveOrder(ctx context.Context, order *model.Order) error {
 		order.OrderUID, order.Payment.Transaction, order.Payment.RequestID, order.Payment.Currency, order.Payment.Provider,
 		order.Payment.Amount, order.Payment.PaymentDt, order.Payment.Bank, order.Payment.DeliveryCost, order.Payment.GoodsTotal, order.Payment.CustomFee)
 	if err != nil {
-		return fmt.Errorf("failed to insert into payments: %w", err)
+		return 0, fmt.Errorf("failed to insert into payments: %w", err)
 	}
 
 	for _, item := range order.Items {
@@ -90,20 +113,94 @@ func (db *DB) SaveOrder(ctx context.Context, order *model.Order) error {
 			item.ChrtID, item.TrackNumber, item.Price, item.Rid, item.Name, item.Sale, item.Size,
 			item.TotalPrice, item.NmID, item.Brand, item.Status, order.OrderUID)
 		if err != nil {
-			return fmt.Errorf("failed to insert into items: %w", err)
+			return 0, fmt.Errorf("failed to insert into items: %w", err)
 		}
 	}
 
-	return tx.Commit(ctx)
+	if err := db.insertOutboxEvents(ctx, tx, []*model.Order{order}); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return model.OrderInserted, nil
 }
 
-func (db *DB) GetOrder(ctx context.Context, orderUID string) (*model.Order, error) {
+// Проверяет, что сделает SaveOrder с заказом, ничего не записывая: OrderInserted для нового заказа,
+// OrderDuplicate для уже сохраненного с тем же содержимым, model.ErrOrderConflict - с другим
+func (db *DB) CheckOrder(ctx context.Context, order *model.Order) (_ model.SaveOutcome, err error) {
+	defer classifyErr(&err)
+	hash, err := model.OrderHash(order)
+	if err != nil {
+		return 0, err
+	}
+
+	var exists bool
+	err = db.pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM orders WHERE order_uid = $1)`, order.OrderUID).Scan(&exists)
+	if err != nil {
+		return 0, fmt.Errorf("failed to check order: %w", err)
+	}
+	if !exists {
+		return model.OrderInserted, nil
+	}
+
+	return db.compareWithStored(ctx, db.pool, order, hash)
+}
+
+// Запрос одной строки в транзакции или вне ее
+type rowQuerier interface {
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+// Сравнивает хэш нового заказа с хэшем уже сохраненного заказа с тем же order_uid.
+// При сохранении хэш читается в той же транзакции, чтобы видеть заказы, добавленные в ней же
+func (db *DB) compareWithStored(ctx context.Context, q rowQuerier, order *model.Order, hash string) (model.SaveOutcome, error) {
+	var storedHash *string
+	err := q.QueryRow(ctx, `SELECT payload_hash FROM orders WHERE order_uid = $1`, order.OrderUID).Scan(&storedHash)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get stored order hash: %w", err)
+	}
+
+	// У заказов, сохраненных до появления payload_hash, хэши считаются по данным из БД
+	// без полей, которые меняют события обновления заказа
+	if storedHash == nil {
+		stored, err := db.GetOrder(ctx, order.OrderUID)
+		if err != nil {
+			return 0, err
+		}
+		legacyHash, err := model.LegacyOrderHash(stored)
+		if err != nil {
+			return 0, err
+		}
+		storedHash = &legacyHash
+
+		if hash, err = model.LegacyOrderHash(order); err != nil {
+			return 0, err
+		}
+	}
+
+	if *storedHash != hash {
+		return 0, fmt.Errorf("%w: order_uid %s", model.ErrOrderConflict, order.OrderUID)
+	}
+
+	return model.OrderDuplicate, nil
+}
+
+// Возвращает model.ErrOrderNotFound, если заказа с таким order_uid нет
+func (db *DB) GetOrder(ctx context.Context, orderUID string) (_ *model.Order, err error) {
+	defer classifyErr(&err)
 	order := &model.Order{}
-	err := db.pool.QueryRow(ctx,
-		`SELECT order_uid, track_number, entry, locale, internal_signature, customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard 
+	err = db.pool.QueryRow(ctx,
+		`SELECT order_uid, track_number, entry, locale, internal_signature, customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard,
+			status, COALESCE(cancel_reason, ''), cancelled_at, updated_at
 		FROM orders WHERE order_uid = $1`, orderUID).
 		Scan(&order.OrderUID, &order.TrackNumber, &order.Entry, &order.Locale, &order.InternalSignature, &order.CustomerID, &order.DeliveryService,
-			&order.Shardkey, &order.SmID, &order.DateCreated, &order.OofShard)
+			&order.Shardkey, &order.SmID, &order.DateCreated, &order.OofShard, &order.Status, &order.CancelReason, &order.CancelledAt, &order.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("%w: order_uid %s", model.ErrOrderNotFound, orderUID)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get order: %w", err)
 	}
@@ -126,7 +223,7 @@ func (db *DB) GetOrder(ctx context.Context, orderUID string) (*model.Order, erro
 	}
 
 	rows, err := db.pool.Query(ctx,
-		`SELECT chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status FROM items WHERE order_uid = $1`, orderUID)
+		`SELECT chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status FROM items WHERE order_uid = $1 ORDER BY chrt_id, rid`, orderUID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get items: %w", err)
 	}
@@ -149,8 +246,10 @@ func (db *DB) GetOrder(ctx context.Context, orderUID string) (*model.Order, erro
 	return order, nil
 }
 
-func (db *DB) GetRecentOrders(ctx context.Context, limit int) ([]*model.Order, error) {
-	rows, err := db.pool.Query(ctx, "SELECT order_uid FROM orders ORDER BY date_created DESC LIMIT $1", limit)
+// Возвращает заказы от новых к старым, пропустив offset первых
+func (db *DB) GetRecentOrders(ctx context.Context, limit, offset int) (_ []*model.Order, err error) {
+	defer classifyErr(&err)
+	rows, err := db.pool.Query(ctx, "SELECT order_uid FROM orders ORDER BY date_created DESC, order_uid LIMIT $1 OFFSET $2", limit, offset)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get recent order UIDs: %w", err)
 	}
@@ -0,0 +1,139 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"orders-service/internal/app/model"
+	"orders-service/internal/app/service/servicetest"
+)
+
+// Заказ, сохраненный до появления payload_hash и затем обновленный событиями,
+// при повторной доставке исходного сообщения остается дубликатом, а не конфликтом
+func TestRedeliveredLegacyOrderAfterUpdate(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	prefix := fmt.Sprintf("test-legacy-%d-", time.Now().UnixNano())
+	t.Cleanup(func() { deleteOrders(t, db, prefix) })
+
+	order := servicetest.NewOrder(prefix + "1")
+	// Товар с меньшим chrt_id идет вторым, чтобы порядок в сообщении отличался от порядка в БД
+	second := order.Items[0]
+	second.ChrtID--
+	second.Rid += "-2"
+	order.Items = append(order.Items, second)
+
+	if _, err := db.SaveOrder(ctx, order); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.pool.Exec(ctx, `UPDATE orders SET payload_hash = NULL WHERE order_uid = $1`, order.OrderUID); err != nil {
+		t.Fatal(err)
+	}
+
+	address := "Lenina 1"
+	update := &model.OrderUpdate{
+		Delivery: &model.DeliveryUpdate{Address: &address},
+		Items:    []model.ItemStatusUpdate{{ChrtID: order.Items[0].ChrtID, Status: 300}},
+	}
+	if err := db.UpdateOrder(ctx, order.OrderUID, update); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, save := range map[string]func(*model.Order) (model.SaveOutcome, error){
+		"SaveOrder":  func(o *model.Order) (model.SaveOutcome, error) { return db.SaveOrder(ctx, o) },
+		"CheckOrder": func(o *model.Order) (model.SaveOutcome, error) { return db.CheckOrder(ctx, o) },
+		"SaveOrders": func(o *model.Order) (model.SaveOutcome, error) {
+			outcomes, err := db.SaveOrders(ctx, []*model.Order{o})
+			if err != nil {
+				return 0, err
+			}
+			return outcomes[0], nil
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if outcome, err := save(order); err != nil || outcome != model.OrderDuplicate {
+				t.Errorf("redelivered order: outcome = %v, err = %v, want duplicate", outcome, err)
+			}
+
+			changed := servicetest.NewOrder(order.OrderUID)
+			changed.Items = append(changed.Items, second)
+			changed.Items[0].Price++
+			if _, err := save(changed); !errors.Is(err, model.ErrOrderConflict) {
+				t.Errorf("changed order: err = %v, want ErrOrderConflict", err)
+			}
+		})
+	}
+}
+
+// Relay получает только первое неопубликованное событие каждого заказа, событие,
+// закрепленное за другим relay, не забирается повторно, а результат relay с истекшей
+// арендой не сохраняется
+func TestClaimOutboxEvents(t *testing.T) {
+	db := newTestDB(t)
+	db.EnableOutbox()
+	ctx := context.Background()
+	prefix := fmt.Sprintf("test-outbox-%d-", time.Now().UnixNano())
+	t.Cleanup(func() {
+		if _, err := db.pool.Exec(ctx, `DELETE FROM outbox WHERE order_uid LIKE $1`, prefix+"%"); err != nil {
+			t.Errorf("failed to clean up outbox: %v", err)
+		}
+		deleteOrders(t, db, prefix)
+	})
+
+	first, second := servicetest.NewOrder(prefix+"1"), servicetest.NewOrder(prefix+"2")
+	if _, err := db.SaveOrders(ctx, []*model.Order{first, second}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.pool.Exec(ctx, `INSERT INTO outbox (order_uid, event_type, payload) VALUES ($1, $2, '{}')`,
+		first.OrderUID, model.EventOrderUpdated); err != nil {
+		t.Fatal(err)
+	}
+
+	claim := func() []*model.OutboxMessage {
+		t.Helper()
+		msgs, err := db.ClaimOutboxEvents(ctx, 1000, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var own []*model.OutboxMessage
+		for _, msg := range msgs {
+			if strings.HasPrefix(msg.OrderUID, prefix) {
+				own = append(own, msg)
+			}
+		}
+		return own
+	}
+	noRetry := func(int) time.Duration { return 0 }
+
+	heads := claim()
+	if len(heads) != 2 || heads[0].OrderUID != first.OrderUID || heads[0].EventType != model.EventOrderPersisted ||
+		heads[1].OrderUID != second.OrderUID {
+		t.Fatalf("first claim = %+v, want order.persisted of both orders", heads)
+	}
+	if again := claim(); len(again) != 0 {
+		t.Fatalf("second claim = %+v, want no events while the lease is held", again)
+	}
+
+	stale := *heads[1]
+	stale.LockedUntil = stale.LockedUntil.Add(-time.Second)
+	if err := db.CompleteOutboxEvents(ctx, []*model.OutboxMessage{heads[0], &stale}, []error{nil, nil}, noRetry); err != nil {
+		t.Fatal(err)
+	}
+
+	next := claim()
+	if len(next) != 1 || next[0].OrderUID != first.OrderUID || next[0].EventType != model.EventOrderUpdated {
+		t.Fatalf("claim after publishing = %+v, want order.updated of the first order", next)
+	}
+
+	var published bool
+	if err := db.pool.QueryRow(ctx, `SELECT published_at IS NOT NULL FROM outbox WHERE id = $1`, heads[1].ID).Scan(&published); err != nil {
+		t.Fatal(err)
+	}
+	if published {
+		t.Error("event was marked published by a relay with an expired lease")
+	}
+}
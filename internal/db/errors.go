@@ -0,0 +1,63 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+
+	"orders-service/internal/app/model"
+
+	"github.com/jackc/pgconn"
+)
+
+// Коды ошибок Postgres, после которых операцию имеет смысл повторить
+var transientCodes = map[string]bool{
+	"40001": true, // serialization_failure
+	"40P01": true, // deadlock_detected
+	"55P03": true, // lock_not_available
+	"57P01": true, // admin_shutdown
+	"57P02": true, // crash_shutdown
+	"57P03": true, // cannot_connect_now
+}
+
+// Дополняет ошибку БД типом: model.ErrUnavailable для временных ошибок, model.ErrOrderConflict для
+// нарушения уникальности и model.ErrDataRejected для отвергнутых данных.
+// Исходная ошибка остается в цепочке
+func classify(err error) error {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch {
+		case transientCodes[pgErr.Code],
+			pgErr.Code[:2] == "08", // connection_exception
+			pgErr.Code[:2] == "53": // insufficient_resources
+			return fmt.Errorf("%w: %w", model.ErrUnavailable, err)
+		case pgErr.Code == "23505": // unique_violation
+			if errors.Is(err, model.ErrOrderConflict) {
+				return err
+			}
+			return fmt.Errorf("%w: %w", model.ErrOrderConflict, err)
+		case pgErr.Code[:2] == "22", pgErr.Code[:2] == "23": // data_exception, integrity_constraint_violation
+			return fmt.Errorf("%w: %w", model.ErrDataRejected, err)
+		}
+		return err
+	}
+
+	var netErr net.Error
+	if pgconn.SafeToRetry(err) || pgconn.Timeout(err) || errors.As(err, &netErr) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("%w: %w", model.ErrUnavailable, err)
+	}
+
+	return err
+}
+
+// Вызывается через defer в публичных методах DB, чтобы все возвращаемые ошибки были типизированы
+func classifyErr(err *error) {
+	*err = classify(*err)
+}
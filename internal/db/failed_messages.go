@@ -0,0 +1,175 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"orders-service/internal/app/model"
+
+	"github.com/jackc/pgx/v4"
+)
+
+const failedMessageColumns = `id, topic, kafka_partition, kafka_offset, payload, content_type, schema_version, failure_kind, error, validation_errors, status, attempts, created_at, updated_at`
+
+// Сохраняет сообщение в карантин. Повторная доставка того же сообщения
+// не создает новую запись, а обновляет ошибку и число попыток. Другое сообщение
+// с теми же координатами (файл spool с тем же именем, источник в памяти после
+// перезапуска) заменяет запись и снова ждет разбора
+func (db *DB) SaveFailedMessage(ctx context.Context, msg *model.FailedMessage) (err error) {
+	defer classifyErr(&err)
+	tx, err := db.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	violations, err := marshalViolations(msg.ValidationErrors)
+	if err != nil {
+		return err
+	}
+
+	err = tx.QueryRow(ctx,
+		`INSERT INTO failed_messages (topic, kafka_partition, kafka_offset, payload, content_type, schema_version, failure_kind, error, validation_errors, status, attempts)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (topic, kafka_partition, kafka_offset) DO UPDATE
+		SET payload = EXCLUDED.payload,
+			content_type = EXCLUDED.content_type,
+			schema_version = EXCLUDED.schema_version,
+			failure_kind = EXCLUDED.failure_kind,
+			error = EXCLUDED.error,
+			validation_errors = EXCLUDED.validation_errors,
+			status = CASE WHEN failed_messages.payload = EXCLUDED.payload THEN failed_messages.status ELSE EXCLUDED.status END,
+			attempts = CASE WHEN failed_messages.payload = EXCLUDED.payload THEN failed_messages.attempts + EXCLUDED.attempts ELSE EXCLUDED.attempts END,
+			updated_at = now()
+		RETURNING id, status, attempts, created_at, updated_at`,
+		msg.Topic, msg.Partition, msg.Offset, msg.Payload, msg.ContentType, msg.SchemaVersion, msg.FailureKind, msg.Error, violations, model.FailedMessagePending, msg.Attempts).
+		Scan(&msg.ID, &msg.Status, &msg.Attempts, &msg.CreatedAt, &msg.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to insert into failed_messages: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// Возвращает сообщения из карантина, начиная с самых старых. Пустой status означает любой статус
+func (db *DB) ListFailedMessages(ctx context.Context, status string, limit, offset int) (_ []*model.FailedMessage, err error) {
+	defer classifyErr(&err)
+	rows, err := db.pool.Query(ctx,
+		`SELECT `+failedMessageColumns+` FROM failed_messages
+		WHERE $1 = '' OR status = $1
+		ORDER BY id LIMIT $2 OFFSET $3`, status, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get failed messages: %w", err)
+	}
+	defer rows.Close()
+
+	var messages []*model.FailedMessage
+	for rows.Next() {
+		msg, err := scanFailedMessage(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan failed message: %w", err)
+		}
+		messages = append(messages, msg)
+	}
+
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("rows error: %w", rows.Err())
+	}
+
+	return messages, nil
+}
+
+func (db *DB) GetFailedMessage(ctx context.Context, id int64) (_ *model.FailedMessage, err error) {
+	defer classifyErr(&err)
+	msg, err := scanFailedMessage(db.pool.QueryRow(ctx,
+		`SELECT `+failedMessageColumns+` FROM failed_messages WHERE id = $1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, model.ErrFailedMessageNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get failed message: %w", err)
+	}
+
+	return msg, nil
+}
+
+// Заменяет тело сообщения, исправленное вручную, вместе с его форматом
+func (db *DB) UpdateFailedMessagePayload(ctx context.Context, id int64, payload []byte, contentType string, schemaVersion int) (err error) {
+	defer classifyErr(&err)
+	tag, err := db.pool.Exec(ctx,
+		`UPDATE failed_messages SET payload = $2, content_type = $3, schema_version = $4, updated_at = now() WHERE id = $1`,
+		id, payload, contentType, schemaVersion)
+	if err != nil {
+		return fmt.Errorf("failed to update failed message payload: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return model.ErrFailedMessageNotFound
+	}
+
+	return nil
+}
+
+// Записывает результат повторной обработки: новый статус и ошибку с нарушениями, если она была.
+// При пустой ошибке сохраняются предыдущие, чтобы не терять историю
+func (db *DB) UpdateFailedMessageStatus(ctx context.Context, id int64, status, errText string, violations []model.Violation) (err error) {
+	defer classifyErr(&err)
+	violationsJSON, err := marshalViolations(violations)
+	if err != nil {
+		return err
+	}
+
+	tag, err := db.pool.Exec(ctx,
+		`UPDATE failed_messages
+		SET status = $2,
+			error = COALESCE(NULLIF($3, ''), error),
+			validation_errors = CASE WHEN $3 = '' THEN validation_errors ELSE $4 END,
+			attempts = attempts + 1,
+			updated_at = now()
+		WHERE id = $1`,
+		id, status, errText, violationsJSON)
+	if err != nil {
+		return fmt.Errorf("failed to update failed message status: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return model.ErrFailedMessageNotFound
+	}
+
+	return nil
+}
+
+func scanFailedMessage(row pgx.Row) (*model.FailedMessage, error) {
+	msg := &model.FailedMessage{}
+	var violations []byte
+	err := row.Scan(&msg.ID, &msg.Topic, &msg.Partition, &msg.Offset, &msg.Payload, &msg.ContentType,
+		&msg.SchemaVersion, &msg.FailureKind, &msg.Error, &violations, &msg.Status, &msg.Attempts, &msg.CreatedAt, &msg.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if violations != nil {
+		if err := json.Unmarshal(violations, &msg.ValidationErrors); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal validation errors: %w", err)
+		}
+	}
+
+	return msg, nil
+}
+
+// Нет нарушений - NULL в validation_errors
+func marshalViolations(violations []model.Violation) ([]byte, error) {
+	if len(violations) == 0 {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(violations)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal validation errors: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,76 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"orders-service/internal/app/model"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Возвращает сохраненные оффсеты партиций топика: для каждой партиции - оффсет
+// следующего сообщения, которое нужно прочитать
+func (db *DB) GetOffsets(ctx context.Context, groupID, topic string) (_ map[int]int64, err error) {
+	defer classifyErr(&err)
+	rows, err := db.pool.Query(ctx,
+		`SELECT kafka_partition, next_offset FROM consumer_offsets WHERE group_id = $1 AND topic = $2`, groupID, topic)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get consumer offsets: %w", err)
+	}
+	defer rows.Close()
+
+	offsets := make(map[int]int64)
+	for rows.Next() {
+		var partition int
+		var offset int64
+		if err := rows.Scan(&partition, &offset); err != nil {
+			return nil, fmt.Errorf("failed to scan consumer offset: %w", err)
+		}
+		offsets[partition] = offset
+	}
+
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("rows error: %w", rows.Err())
+	}
+
+	return offsets, nil
+}
+
+// Начинает транзакцию и сдвигает в ней оффсеты из контекста, если они есть
+func (db *DB) begin(ctx context.Context) (pgx.Tx, error) {
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	if err := storeOffsets(ctx, tx); err != nil {
+		tx.Rollback(ctx)
+		return nil, err
+	}
+
+	return tx, nil
+}
+
+// Сдвигает оффсеты вперед. Строки оффсетов остаются заблокированными до конца транзакции,
+// поэтому если после ребаланса одно сообщение обрабатывают два консьюмера, второй дождется
+// первого и получит model.ErrAlreadyProcessed, а не запишет результат повторно
+func storeOffsets(ctx context.Context, tx pgx.Tx) error {
+	for _, o := range model.OffsetsFromContext(ctx) {
+		tag, err := tx.Exec(ctx,
+			`INSERT INTO consumer_offsets (group_id, topic, kafka_partition, next_offset)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (group_id, topic, kafka_partition) DO UPDATE
+			SET next_offset = EXCLUDED.next_offset, updated_at = now()
+			WHERE consumer_offsets.next_offset < EXCLUDED.next_offset`,
+			o.Group, o.Topic, o.Partition, o.Offset+1)
+		if err != nil {
+			return fmt.Errorf("failed to store consumer offset: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return fmt.Errorf("%w: %s/%d offset %d", model.ErrAlreadyProcessed, o.Topic, o.Partition, o.Offset)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,116 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"orders-service/internal/app/model"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Применяет частичное изменение заказа в одной транзакции
+func (db *DB) UpdateOrder(ctx context.Context, orderUID string, update *model.OrderUpdate) (err error) {
+	defer classifyErr(&err)
+	tx, err := db.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	status, err := lockOrder(ctx, tx, orderUID)
+	if err != nil {
+		return err
+	}
+	if status == model.OrderStatusCancelled {
+		return fmt.Errorf("%w: order_uid %s", model.ErrOrderCancelled, orderUID)
+	}
+
+	if d := update.Delivery; d != nil {
+		_, err = tx.Exec(ctx,
+			`UPDATE deliveries SET
+				name = COALESCE($2, name),
+				phone = COALESCE($3, phone),
+				zip = COALESCE($4, zip),
+				city = COALESCE($5, city),
+				address = COALESCE($6, address),
+				region = COALESCE($7, region),
+				email = COALESCE($8, email)
+			WHERE order_uid = $1`,
+			orderUID, d.Name, d.Phone, d.Zip, d.City, d.Address, d.Region, d.Email)
+		if err != nil {
+			return fmt.Errorf("failed to update delivery: %w", err)
+		}
+	}
+
+	for _, item := range update.Items {
+		tag, err := tx.Exec(ctx,
+			`UPDATE items SET status = $3 WHERE order_uid = $1 AND chrt_id = $2`,
+			orderUID, item.ChrtID, item.Status)
+		if err != nil {
+			return fmt.Errorf("failed to update item status: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return fmt.Errorf("%w: order_uid %s, chrt_id %d", model.ErrItemNotFound, orderUID, item.ChrtID)
+		}
+	}
+
+	if _, err = tx.Exec(ctx, `UPDATE orders SET updated_at = now() WHERE order_uid = $1`, orderUID); err != nil {
+		return fmt.Errorf("failed to update order: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// Отменяет заказ. Повторная отмена ничего не меняет и возвращает OrderDuplicate
+func (db *DB) CancelOrder(ctx context.Context, orderUID, reason string) (_ model.SaveOutcome, err error) {
+	defer classifyErr(&err)
+	tx, err := db.begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	status, err := lockOrder(ctx, tx, orderUID)
+	if err != nil {
+		return 0, err
+	}
+	if status == model.OrderStatusCancelled {
+		if err := tx.Commit(ctx); err != nil {
+			return 0, fmt.Errorf("failed to commit transaction: %w", err)
+		}
+		return model.OrderDuplicate, nil
+	}
+
+	_, err = tx.Exec(ctx,
+		`UPDATE orders SET status = $2, cancel_reason = $3, cancelled_at = now(), updated_at = now() WHERE order_uid = $1`,
+		orderUID, model.OrderStatusCancelled, reason)
+	if err != nil {
+		return 0, fmt.Errorf("failed to cancel order: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return model.OrderUpdated, nil
+}
+
+// Блокирует строку заказа до конца транзакции и возвращает его статус
+func lockOrder(ctx context.Context, tx pgx.Tx, orderUID string) (string, error) {
+	var status string
+	err := tx.QueryRow(ctx, `SELECT status FROM orders WHERE order_uid = $1 FOR UPDATE`, orderUID).Scan(&status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", fmt.Errorf("%w: order_uid %s", model.ErrOrderNotFound, orderUID)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to lock order: %w", err)
+	}
+
+	return status, nil
+}
@@ -0,0 +1,118 @@
+package db
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"orders-service/internal/app/model"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Включает запись событий order.persisted в outbox при сохранении новых заказов
+func (db *DB) EnableOutbox() {
+	db.outbox = true
+}
+
+// Записывает в outbox события о сохранении новых заказов в транзакции их сохранения
+func (db *DB) insertOutboxEvents(ctx context.Context, tx pgx.Tx, orders []*model.Order) error {
+	if !db.outbox || len(orders) == 0 {
+		return nil
+	}
+
+	batch := &pgx.Batch{}
+	for _, order := range orders {
+		payload, err := json.Marshal(model.OrderEvent{
+			Type:     model.EventOrderPersisted,
+			OrderUID: order.OrderUID,
+			Order:    order,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to marshal outbox event: %w", err)
+		}
+		batch.Queue(`INSERT INTO outbox (order_uid, event_type, payload) VALUES ($1, $2, $3)`,
+			order.OrderUID, model.EventOrderPersisted, string(payload))
+	}
+
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("failed to insert into outbox: %w", err)
+	}
+
+	return nil
+}
+
+// Забирает очередную порцию событий из outbox и закрепляет их за вызывающим relay на lease.
+// Из каждого order_uid берется только самое раннее неопубликованное событие, поэтому следующее
+// событие заказа не уйдет, пока не опубликовано предыдущее. События, закрепленные другим relay,
+// пропускаются, пока не истечет их аренда. События возвращаются в порядке записи
+func (db *DB) ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) (_ []*model.OutboxMessage, err error) {
+	defer classifyErr(&err)
+	rows, err := db.pool.Query(ctx,
+		`UPDATE outbox SET locked_until = now() + $2::bigint * interval '1 millisecond'
+		WHERE id IN (
+			SELECT id FROM outbox o
+			WHERE published_at IS NULL AND next_attempt_at <= now()
+				AND (locked_until IS NULL OR locked_until < now())
+				AND NOT EXISTS (
+					SELECT 1 FROM outbox prev
+					WHERE prev.order_uid = o.order_uid AND prev.published_at IS NULL AND prev.id < o.id
+				)
+			ORDER BY id LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, order_uid, event_type, payload, attempts, created_at, locked_until`,
+		limit, lease.Milliseconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim outbox events: %w", err)
+	}
+	defer rows.Close()
+
+	var msgs []*model.OutboxMessage
+	for rows.Next() {
+		msg := &model.OutboxMessage{}
+		if err := rows.Scan(&msg.ID, &msg.OrderUID, &msg.EventType, &msg.Payload, &msg.Attempts, &msg.CreatedAt, &msg.LockedUntil); err != nil {
+			return nil, fmt.Errorf("failed to scan outbox event: %w", err)
+		}
+		msgs = append(msgs, msg)
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("rows error: %w", rows.Err())
+	}
+
+	slices.SortFunc(msgs, func(a, b *model.OutboxMessage) int { return cmp.Compare(a.ID, b.ID) })
+	return msgs, nil
+}
+
+// Сохраняет результат публикации событий, забранных ClaimOutboxEvents: errs[i] - ошибка
+// публикации msgs[i] (nil, если событие опубликовано). Неопубликованные события откладываются
+// на retryDelay(attempts). Если аренда события истекла и его уже забрал другой relay,
+// результат для него не сохраняется
+func (db *DB) CompleteOutboxEvents(ctx context.Context, msgs []*model.OutboxMessage, errs []error,
+	retryDelay func(attempts int) time.Duration,
+) (err error) {
+	defer classifyErr(&err)
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	batch := &pgx.Batch{}
+	for i, msg := range msgs {
+		if errs[i] == nil {
+			batch.Queue(`UPDATE outbox SET published_at = now(), attempts = attempts + 1, locked_until = NULL
+				WHERE id = $1 AND locked_until = $2`, msg.ID, msg.LockedUntil)
+			continue
+		}
+		batch.Queue(`UPDATE outbox SET attempts = attempts + 1, last_error = $3, next_attempt_at = $4, locked_until = NULL
+			WHERE id = $1 AND locked_until = $2`,
+			msg.ID, msg.LockedUntil, errs[i].Error(), time.Now().Add(retryDelay(msg.Attempts+1)))
+	}
+	if err := db.pool.SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("failed to update outbox events: %w", err)
+	}
+
+	return nil
+}
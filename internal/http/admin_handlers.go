@@ -0,0 +1,192 @@
+package http
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"orders-service/internal/app/model"
+	"orders-service/internal/app/service"
+	"orders-service/internal/codec"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 500
+	maxPayloadSize   = 1 << 20
+)
+
+// Сообщение из карантина с телом в виде строки, чтобы его было удобно читать и править.
+// Тело в двоичном формате (Protobuf, Avro) передается в base64
+type failedMessageView struct {
+	*model.FailedMessage
+	Payload         string `json:"payload"`
+	PayloadEncoding string `json:"payload_encoding,omitempty"`
+}
+
+// Ответ на заказ, не прошедший проверку: текст ошибки и все нарушения с путями к полям
+type validationErrorResponse struct {
+	Error            string            `json:"error"`
+	ValidationErrors []model.Violation `json:"validation_errors,omitempty"`
+}
+
+func newFailedMessageView(msg *model.FailedMessage) failedMessageView {
+	if msg.ContentType == codec.ContentTypeJSON {
+		return failedMessageView{FailedMessage: msg, Payload: string(msg.Payload)}
+	}
+	return failedMessageView{
+		FailedMessage:   msg,
+		Payload:         base64.StdEncoding.EncodeToString(msg.Payload),
+		PayloadEncoding: "base64",
+	}
+}
+
+// GET /admin/failed-messages?status=pending&limit=50&offset=0
+func (h *Handlers) listFailedMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	limit, err := intQueryParam(query.Get("limit"), defaultListLimit)
+	if err != nil || limit <= 0 || limit > maxListLimit {
+		http.Error(w, "Invalid limit", http.StatusBadRequest)
+		return
+	}
+	offset, err := intQueryParam(query.Get("offset"), 0)
+	if err != nil || offset < 0 {
+		http.Error(w, "Invalid offset", http.StatusBadRequest)
+		return
+	}
+
+	messages, err := h.svc.ListFailedMessages(r.Context(), query.Get("status"), limit, offset)
+	if err != nil {
+		h.writeServiceError(w, err, "Failed to list failed messages")
+		return
+	}
+
+	views := make([]failedMessageView, 0, len(messages))
+	for _, msg := range messages {
+		views = append(views, newFailedMessageView(msg))
+	}
+	h.writeJSON(w, http.StatusOK, views)
+}
+
+// GET /admin/failed-messages/{id}
+func (h *Handlers) getFailedMessageHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := failedMessageID(w, r)
+	if !ok {
+		return
+	}
+
+	msg, err := h.svc.GetFailedMessage(r.Context(), id)
+	if err != nil {
+		h.writeFailedMessageError(w, err, id)
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, newFailedMessageView(msg))
+}
+
+// PUT /admin/failed-messages/{id}/payload?content_type=application/json&schema_version=1,
+// тело запроса - исправленное сообщение. Без параметров тело считается JSON первой версии
+func (h *Handlers) updateFailedMessagePayloadHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := failedMessageID(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	format, err := codec.ParseFormat(query.Get("content_type"), query.Get("schema_version"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPayloadSize))
+	if err != nil {
+		http.Error(w, "Failed to read payload", http.StatusBadRequest)
+		return
+	}
+	if len(payload) == 0 {
+		http.Error(w, "Payload is empty", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.svc.UpdateFailedMessagePayload(r.Context(), id, payload, format); err != nil {
+		h.writeFailedMessageError(w, err, id)
+		return
+	}
+
+	msg, err := h.svc.GetFailedMessage(r.Context(), id)
+	if err != nil {
+		h.writeFailedMessageError(w, err, id)
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, newFailedMessageView(msg))
+}
+
+// POST /admin/failed-messages/{id}/reprocess
+func (h *Handlers) reprocessFailedMessageHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := failedMessageID(w, r)
+	if !ok {
+		return
+	}
+
+	msg, err := h.svc.ReprocessFailedMessage(r.Context(), id)
+	if err != nil {
+		h.writeFailedMessageError(w, err, id)
+		return
+	}
+
+	h.logger.Info("Failed message reprocessed", zap.Int64("failed_message_id", id))
+	h.writeJSON(w, http.StatusOK, newFailedMessageView(msg))
+}
+
+func (h *Handlers) writeFailedMessageError(w http.ResponseWriter, err error, id int64) {
+	switch {
+	case errors.Is(err, service.ErrFailedMessageNotFound):
+		http.Error(w, "Failed message not found", http.StatusNotFound)
+	case errors.Is(err, service.ErrFailedMessageResolved):
+		http.Error(w, "Failed message is already reprocessed", http.StatusConflict)
+	case errors.Is(err, service.ErrOrderConflict),
+		errors.Is(err, service.ErrOrderNotFound),
+		errors.Is(err, service.ErrItemNotFound),
+		errors.Is(err, service.ErrOrderCancelled):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, service.ErrInvalidOrder):
+		h.writeJSON(w, http.StatusUnprocessableEntity, validationErrorResponse{
+			Error:            err.Error(),
+			ValidationErrors: model.Violations(err),
+		})
+	default:
+		h.writeServiceError(w, err, "Failed message operation failed", zap.Int64("failed_message_id", id))
+	}
+}
+
+func (h *Handlers) writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		h.logger.Error("Failed to encode response", zap.Error(err))
+	}
+}
+
+func failedMessageID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid failed message id", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+func intQueryParam(value string, def int) (int, error) {
+	if value == "" {
+		return def, nil
+	}
+	return strconv.Atoi(value)
+}
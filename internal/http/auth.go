@@ -0,0 +1,27 @@
+package http
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// Пропускает к административным эндпоинтам только запросы с заголовком
+// Authorization: Bearer <token>. Пустой token выключает эндпоинты целиком
+func requireAdminToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token == "" {
+			http.Error(w, "Admin API is disabled, set ADMIN_TOKEN to enable it", http.StatusForbidden)
+			return
+		}
+
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			http.Error(w, "Invalid or missing admin token", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
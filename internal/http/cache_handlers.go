@@ -0,0 +1,10 @@
+package http
+
+import (
+	"net/http"
+)
+
+// GET /admin/cache. Число заказов в кэше, их оценочный размер в байтах и ограничения кэша
+func (h *Handlers) cacheStatsHandler(w http.ResponseWriter, r *http.Request) {
+	h.writeJSON(w, http.StatusOK, h.cache.Stats())
+}
@@ -0,0 +1,22 @@
+package http
+
+import (
+	"net/http"
+)
+
+// POST /admin/consumer/pause. Повторный вызов ничего не меняет
+func (h *Handlers) pauseConsumerHandler(w http.ResponseWriter, r *http.Request) {
+	h.consumer.Pause()
+	h.writeJSON(w, http.StatusOK, h.consumer.Status())
+}
+
+// POST /admin/consumer/resume. Повторный вызов ничего не меняет
+func (h *Handlers) resumeConsumerHandler(w http.ResponseWriter, r *http.Request) {
+	h.consumer.Resume()
+	h.writeJSON(w, http.StatusOK, h.consumer.Status())
+}
+
+// GET /admin/consumer/status
+func (h *Handlers) consumerStatusHandler(w http.ResponseWriter, r *http.Request) {
+	h.writeJSON(w, http.StatusOK, h.consumer.Status())
+}
@@ -1,23 +1,74 @@
 package http
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 
+	"orders-service/internal/app/model"
 	"orders-service/internal/app/service"
+	"orders-service/internal/cache"
+	"orders-service/internal/codec"
+	"orders-service/internal/consumer"
+	"orders-service/internal/replay"
+	"orders-service/internal/rules"
 
 	"go.uber.org/zap"
 )
 
+// Методы сервиса заказов, которые нужны обработчикам. Реализуется *service.OrderService
+type OrderService interface {
+	GetOrder(ctx context.Context, orderUID string) (*model.Order, error)
+	ListFailedMessages(ctx context.Context, status string, limit, offset int) ([]*model.FailedMessage, error)
+	GetFailedMessage(ctx context.Context, id int64) (*model.FailedMessage, error)
+	UpdateFailedMessagePayload(ctx context.Context, id int64, payload []byte, format codec.Format) error
+	ReprocessFailedMessage(ctx context.Context, id int64) (*model.FailedMessage, error)
+}
+
+// Воспроизведение истории заказов. Реализуется *replay.Replayer
+type Replayer interface {
+	Replay(ctx context.Context, req replay.Request) (*replay.Report, error)
+}
+
+// Управление чтением сообщений. Реализуется *consumer.Consumer
+type ConsumerControl interface {
+	Pause() bool
+	Resume() bool
+	Status() consumer.Status
+}
+
+// Правила проверки из файла. Реализуется *rules.Store
+type RulesStore interface {
+	Path() string
+	Current() *rules.Set
+	Reload() (*rules.Set, error)
+}
+
+// Заполненность кэша заказов. Реализуется *cache.Cache
+type CacheStats interface {
+	Stats() cache.Stats
+}
+
 type Handlers struct {
-	svc    *service.OrderService
-	logger *zap.Logger
+	svc      OrderService
+	replayer Replayer
+	consumer ConsumerControl
+	rules    RulesStore
+	cache    CacheStats
+	logger   *zap.Logger
 }
 
-func NewHandlers(svc *service.OrderService, logger *zap.Logger) *Handlers {
+// replayer может быть nil, если источник заказов не поддерживает воспроизведение,
+// rules - если файл правил проверки не задан
+func NewHandlers(svc OrderService, replayer Replayer, consumer ConsumerControl, rules RulesStore, cache CacheStats, logger *zap.Logger) *Handlers {
 	return &Handlers{
-		svc:    svc,
-		logger: logger,
+		svc:      svc,
+		replayer: replayer,
+		consumer: consumer,
+		rules:    rules,
+		cache:    cache,
+		logger:   logger,
 	}
 }
 
@@ -32,10 +83,13 @@ func (h *Handlers) orderHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	order, err := h.svc.GetOrder(r.Context(), orderUID)
-	if err != nil {
-		h.logger.Error("Order not found or database error", zap.Error(err), zap.String("order_uid", orderUID))
+	switch {
+	case errors.Is(err, service.ErrOrderNotFound):
 		http.Error(w, "Order not found", http.StatusNotFound)
 		return
+	case err != nil:
+		h.writeServiceError(w, err, "Failed to get order", zap.String("order_uid", orderUID))
+		return
 	}
 
 	if err := json.NewEncoder(w).Encode(order); err != nil {
@@ -43,3 +97,23 @@ func (h *Handlers) orderHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
 	}
 }
+
+// Отвечает на ошибку сервиса, для которой у обработчика нет своего статуса: 503, если БД
+// недоступна, 504, если она не ответила вовремя, и 500 на остальные ошибки, которые
+// пишутся в лог как msg. На запрос, отмененный клиентом, ответ не отправляется
+func (h *Handlers) writeServiceError(w http.ResponseWriter, err error, msg string, fields ...zap.Field) {
+	fields = append(fields, zap.Error(err))
+	switch {
+	case errors.Is(err, service.ErrUnavailable):
+		h.logger.Warn("Database is unavailable", fields...)
+		http.Error(w, "Service temporarily unavailable", http.StatusServiceUnavailable)
+	case errors.Is(err, context.DeadlineExceeded):
+		h.logger.Warn("Request timed out", fields...)
+		http.Error(w, "Request timed out", http.StatusGatewayTimeout)
+	case errors.Is(err, context.Canceled):
+		// Клиент закрыл соединение, отвечать некому
+	default:
+		h.logger.Error(msg, fields...)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,361 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"orders-service/internal/app/model"
+	"orders-service/internal/app/service"
+	"orders-service/internal/app/service/servicetest"
+	"orders-service/internal/cache"
+	"orders-service/internal/codec"
+	"orders-service/internal/consumer"
+	"orders-service/internal/replay"
+
+	"go.uber.org/zap"
+)
+
+type fakeConsumer struct {
+	paused bool
+}
+
+func (c *fakeConsumer) Pause() bool {
+	changed := !c.paused
+	c.paused = true
+	return changed
+}
+
+func (c *fakeConsumer) Resume() bool {
+	changed := c.paused
+	c.paused = false
+	return changed
+}
+
+func (c *fakeConsumer) Status() consumer.Status {
+	return consumer.Status{Paused: c.paused}
+}
+
+type fakeCacheStats cache.Stats
+
+func (s fakeCacheStats) Stats() cache.Stats {
+	return cache.Stats(s)
+}
+
+type fakeReplayer struct {
+	report *replay.Report
+	err    error
+}
+
+func (r *fakeReplayer) Replay(context.Context, replay.Request) (*replay.Report, error) {
+	return r.report, r.err
+}
+
+const testAdminToken = "secret"
+
+type testServer struct {
+	mux      *http.ServeMux
+	repo     *servicetest.Repository
+	consumer *fakeConsumer
+}
+
+// Обработчики поверх настоящего сервиса с хранилищем и кэшем в памяти
+func newTestServer(t *testing.T, replayer Replayer) *testServer {
+	t.Helper()
+
+	decoder, err := codec.NewRegistry("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := servicetest.NewRepository()
+	svc := service.NewOrderService(repo, servicetest.NewCache(), decoder, service.Validation{}, zap.NewNop())
+	ts := &testServer{repo: repo, consumer: &fakeConsumer{}}
+	stats := fakeCacheStats{Entries: 3, Bytes: 4096, MaxEntries: 100}
+	ts.mux = newMux(NewHandlers(svc, replayer, ts.consumer, nil, stats, zap.NewNop()), testAdminToken)
+	return ts
+}
+
+func (ts *testServer) do(method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+
+	rec := httptest.NewRecorder()
+	ts.mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func decode[T any](t *testing.T, rec *httptest.ResponseRecorder) T {
+	t.Helper()
+
+	var v T
+	if err := json.NewDecoder(rec.Body).Decode(&v); err != nil {
+		t.Fatalf("failed to decode response %q: %v", rec.Body.String(), err)
+	}
+	return v
+}
+
+func TestGetOrder(t *testing.T) {
+	ts := newTestServer(t, nil)
+	if _, err := ts.repo.SaveOrder(context.Background(), servicetest.NewOrder("order-1")); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := ts.do(http.MethodGet, "/orders/order-1", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	order := decode[model.Order](t, rec)
+	if order.OrderUID != "order-1" || len(order.Items) != 1 {
+		t.Errorf("order = %+v", order)
+	}
+
+	if rec := ts.do(http.MethodGet, "/orders/", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("empty order_uid: status = %d, want 400", rec.Code)
+	}
+}
+
+func TestFailedMessageLifecycle(t *testing.T) {
+	ts := newTestServer(t, nil)
+	msg := &model.FailedMessage{
+		Topic:         "orders",
+		Offset:        3,
+		Payload:       []byte(`{"order_uid": "order-1"}`),
+		ContentType:   codec.ContentTypeJSON,
+		SchemaVersion: 1,
+		FailureKind:   consumer.FailureValidation,
+		Error:         "invalid order",
+	}
+	if err := ts.repo.SaveFailedMessage(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := ts.do(http.MethodGet, "/admin/failed-messages?status=pending", "")
+	if list := decode[[]failedMessageView](t, rec); rec.Code != http.StatusOK || len(list) != 1 || list[0].Payload != string(msg.Payload) {
+		t.Fatalf("list: status = %d, body = %+v", rec.Code, list)
+	}
+
+	if rec := ts.do(http.MethodGet, "/admin/failed-messages/99", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("get missing: status = %d, want 404", rec.Code)
+	}
+	if rec := ts.do(http.MethodGet, "/admin/failed-messages/abc", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("get invalid id: status = %d, want 400", rec.Code)
+	}
+	if rec := ts.do(http.MethodGet, "/admin/failed-messages?limit=0", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("list with zero limit: status = %d, want 400", rec.Code)
+	}
+
+	rec = ts.do(http.MethodPost, "/admin/failed-messages/1/reprocess", "")
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("reprocess invalid payload: status = %d, want 422: %s", rec.Code, rec.Body)
+	}
+	if resp := decode[validationErrorResponse](t, rec); len(resp.ValidationErrors) == 0 {
+		t.Error("422 response has no validation errors")
+	}
+
+	payload, err := json.Marshal(servicetest.NewOrder("order-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec = ts.do(http.MethodPut, "/admin/failed-messages/1/payload", string(payload))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("update payload: status = %d: %s", rec.Code, rec.Body)
+	}
+	if rec := ts.do(http.MethodPut, "/admin/failed-messages/1/payload?content_type=text/plain", "x"); rec.Code != http.StatusBadRequest {
+		t.Errorf("update with unsupported content type: status = %d, want 400", rec.Code)
+	}
+
+	rec = ts.do(http.MethodPost, "/admin/failed-messages/1/reprocess", "")
+	if view := decode[failedMessageView](t, rec); rec.Code != http.StatusOK || view.Status != model.FailedMessageReprocessed {
+		t.Fatalf("reprocess: status = %d, message = %+v", rec.Code, view)
+	}
+	if len(ts.repo.Orders()) != 1 {
+		t.Error("reprocessed order is not saved")
+	}
+
+	if rec := ts.do(http.MethodPost, "/admin/failed-messages/1/reprocess", ""); rec.Code != http.StatusConflict {
+		t.Errorf("second reprocess: status = %d, want 409", rec.Code)
+	}
+}
+
+func TestConsumerControl(t *testing.T) {
+	ts := newTestServer(t, nil)
+
+	rec := ts.do(http.MethodPost, "/admin/consumer/pause", "")
+	if status := decode[consumer.Status](t, rec); rec.Code != http.StatusOK || !status.Paused {
+		t.Fatalf("pause: status = %d, body = %+v", rec.Code, status)
+	}
+
+	rec = ts.do(http.MethodPost, "/admin/consumer/resume", "")
+	if status := decode[consumer.Status](t, rec); rec.Code != http.StatusOK || status.Paused {
+		t.Fatalf("resume: status = %d, body = %+v", rec.Code, status)
+	}
+}
+
+func TestCacheStats(t *testing.T) {
+	ts := newTestServer(t, nil)
+
+	rec := ts.do(http.MethodGet, "/admin/cache", "")
+	if stats := decode[cache.Stats](t, rec); rec.Code != http.StatusOK || stats.Entries != 3 || stats.Bytes != 4096 {
+		t.Fatalf("status = %d, stats = %+v", rec.Code, stats)
+	}
+}
+
+func TestOptionalFeaturesAreNotImplemented(t *testing.T) {
+	ts := newTestServer(t, nil)
+
+	for _, tc := range []struct{ method, target string }{
+		{http.MethodPost, "/admin/replay"},
+		{http.MethodGet, "/admin/validation-rules"},
+		{http.MethodPost, "/admin/validation-rules/reload"},
+	} {
+		if rec := ts.do(tc.method, tc.target, "{}"); rec.Code != http.StatusNotImplemented {
+			t.Errorf("%s %s: status = %d, want 501", tc.method, tc.target, rec.Code)
+		}
+	}
+}
+
+func TestReplay(t *testing.T) {
+	replayer := &fakeReplayer{report: &replay.Report{Topic: "orders", Counts: replay.Counts{Messages: 2, Inserted: 2}}}
+	ts := newTestServer(t, replayer)
+
+	rec := ts.do(http.MethodPost, "/admin/replay", `{"from": {"timestamp": "2024-01-01T00:00:00Z"}}`)
+	if report := decode[replay.Report](t, rec); rec.Code != http.StatusOK || report.Inserted != 2 {
+		t.Fatalf("status = %d, report = %+v", rec.Code, report)
+	}
+
+	if rec := ts.do(http.MethodPost, "/admin/replay", `{"unknown": true}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown field: status = %d, want 400", rec.Code)
+	}
+
+	for _, tc := range []struct {
+		err  error
+		want int
+	}{
+		{replay.ErrInvalidRequest, http.StatusBadRequest},
+		{replay.ErrInProgress, http.StatusConflict},
+		{context.DeadlineExceeded, http.StatusBadGateway},
+	} {
+		replayer.err = tc.err
+		if rec := ts.do(http.MethodPost, "/admin/replay", `{}`); rec.Code != tc.want {
+			t.Errorf("replay error %v: status = %d, want %d", tc.err, rec.Code, tc.want)
+		}
+	}
+}
+
+// Сервис, который на любой запрос заказа или сообщения из карантина возвращает заданную ошибку
+type failingOrderService struct {
+	OrderService
+	err error
+}
+
+func (s failingOrderService) GetOrder(context.Context, string) (*model.Order, error) {
+	return nil, s.err
+}
+
+func (s failingOrderService) ListFailedMessages(context.Context, string, int, int) ([]*model.FailedMessage, error) {
+	return nil, s.err
+}
+
+func (s failingOrderService) GetFailedMessage(context.Context, int64) (*model.FailedMessage, error) {
+	return nil, s.err
+}
+
+func (s failingOrderService) ReprocessFailedMessage(context.Context, int64) (*model.FailedMessage, error) {
+	return nil, s.err
+}
+
+func TestGetOrderErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"not found", fmt.Errorf("getting order from db: %w: order_uid x", service.ErrOrderNotFound), http.StatusNotFound},
+		{"database unavailable", fmt.Errorf("getting order from db: %w: connection refused", service.ErrUnavailable), http.StatusServiceUnavailable},
+		{"database timeout", fmt.Errorf("getting order from db: %w", context.DeadlineExceeded), http.StatusGatewayTimeout},
+		{"unknown error", errors.New("boom"), http.StatusInternalServerError},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mux := newMux(NewHandlers(failingOrderService{err: tc.err}, nil, &fakeConsumer{}, nil, fakeCacheStats{}, zap.NewNop()), testAdminToken)
+
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/orders/x", nil))
+			if rec.Code != tc.want {
+				t.Errorf("status = %d, want %d", rec.Code, tc.want)
+			}
+		})
+	}
+}
+
+func TestFailedMessageErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"database unavailable", fmt.Errorf("listing failed messages: %w: connection refused", service.ErrUnavailable), http.StatusServiceUnavailable},
+		{"database timeout", fmt.Errorf("listing failed messages: %w", context.DeadlineExceeded), http.StatusGatewayTimeout},
+		{"unknown error", errors.New("boom"), http.StatusInternalServerError},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mux := newMux(NewHandlers(failingOrderService{err: tc.err}, nil, &fakeConsumer{}, nil, fakeCacheStats{}, zap.NewNop()), testAdminToken)
+
+			for _, req := range []struct{ method, target string }{
+				{http.MethodGet, "/admin/failed-messages"},
+				{http.MethodGet, "/admin/failed-messages/1"},
+				{http.MethodPost, "/admin/failed-messages/1/reprocess"},
+			} {
+				r := httptest.NewRequest(req.method, req.target, nil)
+				r.Header.Set("Authorization", "Bearer "+testAdminToken)
+
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, r)
+				if rec.Code != tc.want {
+					t.Errorf("%s %s: status = %d, want %d", req.method, req.target, rec.Code, tc.want)
+				}
+			}
+		})
+	}
+}
+
+func TestAdminRequiresToken(t *testing.T) {
+	h := NewHandlers(failingOrderService{}, nil, &fakeConsumer{}, nil, fakeCacheStats{}, zap.NewNop())
+
+	for _, tc := range []struct {
+		name          string
+		adminToken    string
+		authorization string
+		want          int
+	}{
+		{"valid token", testAdminToken, "Bearer " + testAdminToken, http.StatusOK},
+		{"missing token", testAdminToken, "", http.StatusUnauthorized},
+		{"wrong token", testAdminToken, "Bearer other", http.StatusUnauthorized},
+		{"wrong scheme", testAdminToken, "Basic " + testAdminToken, http.StatusUnauthorized},
+		{"admin API disabled", "", "Bearer ", http.StatusForbidden},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/admin/cache", nil)
+			if tc.authorization != "" {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+
+			rec := httptest.NewRecorder()
+			newMux(h, tc.adminToken).ServeHTTP(rec, req)
+			if rec.Code != tc.want {
+				t.Errorf("status = %d, want %d", rec.Code, tc.want)
+			}
+		})
+	}
+
+	// Заказы по-прежнему доступны без токена
+	rec := httptest.NewRecorder()
+	newMux(h, "").ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/orders/", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("orders without token: status = %d, want 400", rec.Code)
+	}
+}
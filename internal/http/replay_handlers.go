@@ -0,0 +1,46 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"orders-service/internal/replay"
+
+	"go.uber.org/zap"
+)
+
+const maxReplayRequestSize = 64 << 10
+
+// POST /admin/replay, тело запроса:
+// {"partitions": [{"partition": 0, "offset": 100}], "from": {"timestamp": "2024-01-01T00:00:00Z"}, "dry_run": true}
+func (h *Handlers) replayHandler(w http.ResponseWriter, r *http.Request) {
+	if h.replayer == nil {
+		http.Error(w, "Replay is available only for the kafka order source", http.StatusNotImplemented)
+		return
+	}
+
+	var req replay.Request
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxReplayRequestSize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		http.Error(w, "Invalid replay request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report, err := h.replayer.Replay(r.Context(), req)
+	switch {
+	case errors.Is(err, replay.ErrInvalidRequest):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, replay.ErrInProgress):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		h.logger.Error("Replay failed", zap.Error(err))
+		http.Error(w, "Replay failed", http.StatusBadGateway)
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, report)
+}
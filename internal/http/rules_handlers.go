@@ -0,0 +1,44 @@
+package http
+
+import (
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type validationRulesResponse struct {
+	File     string    `json:"file"`
+	Rules    int       `json:"rules"`
+	LoadedAt time.Time `json:"loaded_at"`
+}
+
+// POST /admin/validation-rules/reload. Если файл содержит ошибку, продолжают
+// действовать прежние правила, а ошибка возвращается с кодом 422
+func (h *Handlers) reloadValidationRulesHandler(w http.ResponseWriter, r *http.Request) {
+	if h.rules == nil {
+		http.Error(w, "VALIDATION_RULES_FILE is not configured", http.StatusNotImplemented)
+		return
+	}
+
+	set, err := h.rules.Reload()
+	if err != nil {
+		h.logger.Warn("Failed to reload validation rules, keeping previous rules", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	h.logger.Info("Validation rules reloaded", zap.String("file", h.rules.Path()), zap.Int("rules", set.Len()))
+
+	h.writeJSON(w, http.StatusOK, validationRulesResponse{File: h.rules.Path(), Rules: set.Len(), LoadedAt: set.LoadedAt})
+}
+
+// GET /admin/validation-rules
+func (h *Handlers) validationRulesHandler(w http.ResponseWriter, r *http.Request) {
+	if h.rules == nil {
+		http.Error(w, "VALIDATION_RULES_FILE is not configured", http.StatusNotImplemented)
+		return
+	}
+
+	set := h.rules.Current()
+	h.writeJSON(w, http.StatusOK, validationRulesResponse{File: h.rules.Path(), Rules: set.Len(), LoadedAt: set.LoadedAt})
+}
@@ -6,34 +6,33 @@ import (
 	"fmt"
 	"net/http"
 
-	"orders-service/internal/app/service"
-
 	"go.uber.org/zap"
 )
 
 type Server struct {
 	handlers   *Handlers
+	adminToken string
 	logger     *zap.Logger
 	httpServer *http.Server
 }
 
-func NewServer(svc *service.OrderService, logger *zap.Logger) (*Server, error) {
+// Административные эндпоинты /admin/* требуют adminToken, пустой токен их выключает
+func NewServer(svc OrderService, replayer Replayer, consumer ConsumerControl, rules RulesStore, cache CacheStats, adminToken string, logger *zap.Logger) (*Server, error) {
 	return &Server{
-		handlers: NewHandlers(svc, logger),
-		logger:   logger,
+		handlers:   NewHandlers(svc, replayer, consumer, rules, cache, logger),
+		adminToken: adminToken,
+		logger:     logger,
 	}, nil
 }
 
 func (s *Server) Start(port int) {
-	mux := http.NewServeMux()
-
-	mux.HandleFunc("/orders/", s.handlers.orderHandler)
-
-	mux.Handle("/", http.StripPrefix("/", http.FileServer(http.Dir("./web"))))
-
 	s.httpServer = &http.Server{
 		Addr:    fmt.Sprintf(":%d", port),
-		Handler: mux,
+		Handler: newMux(s.handlers, s.adminToken),
+	}
+
+	if s.adminToken == "" {
+		s.logger.Warn("ADMIN_TOKEN is not set, admin API is disabled")
 	}
 
 	s.logger.Info("Starting HTTP server", zap.Int("port", port))
@@ -46,3 +45,35 @@ func (s *Server) Shutdown(ctx context.Context) error {
 	s.logger.Info("Shutting down HTTP server...")
 	return s.httpServer.Shutdown(ctx)
 }
+
+func newMux(h *Handlers, adminToken string) *http.ServeMux {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/orders/", h.orderHandler)
+	mux.Handle("/admin/", requireAdminToken(adminToken, newAdminMux(h)))
+	mux.Handle("/", http.StripPrefix("/", http.FileServer(http.Dir("./web"))))
+
+	return mux
+}
+
+func newAdminMux(h *Handlers) *http.ServeMux {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /admin/failed-messages", h.listFailedMessagesHandler)
+	mux.HandleFunc("GET /admin/failed-messages/{id}", h.getFailedMessageHandler)
+	mux.HandleFunc("PUT /admin/failed-messages/{id}/payload", h.updateFailedMessagePayloadHandler)
+	mux.HandleFunc("POST /admin/failed-messages/{id}/reprocess", h.reprocessFailedMessageHandler)
+
+	mux.HandleFunc("POST /admin/replay", h.replayHandler)
+
+	mux.HandleFunc("POST /admin/consumer/pause", h.pauseConsumerHandler)
+	mux.HandleFunc("POST /admin/consumer/resume", h.resumeConsumerHandler)
+	mux.HandleFunc("GET /admin/consumer/status", h.consumerStatusHandler)
+
+	mux.HandleFunc("GET /admin/validation-rules", h.validationRulesHandler)
+	mux.HandleFunc("POST /admin/validation-rules/reload", h.reloadValidationRulesHandler)
+
+	mux.HandleFunc("GET /admin/cache", h.cacheStatsHandler)
+
+	return mux
+}
@@ -0,0 +1,125 @@
+package kafka
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"time"
+
+	"orders-service/internal/configs"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+const dialTimeout = 10 * time.Second
+
+// Dialer для читателей и consumer group с настроенными TLS и SASL
+func newDialer(cfg configs.Kafka) (*kafka.Dialer, error) {
+	tlsConfig, mechanism, err := newSecurity(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kafka.Dialer{
+		Timeout:       dialTimeout,
+		DualStack:     true,
+		TLS:           tlsConfig,
+		SASLMechanism: mechanism,
+	}, nil
+}
+
+// Transport для writer'ов с теми же TLS и SASL, что и у читателей
+func newTransport(cfg configs.Kafka) (*kafka.Transport, error) {
+	tlsConfig, mechanism, err := newSecurity(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kafka.Transport{
+		DialTimeout: dialTimeout,
+		TLS:         tlsConfig,
+		SASL:        mechanism,
+	}, nil
+}
+
+func newSecurity(cfg configs.Kafka) (*tls.Config, sasl.Mechanism, error) {
+	tlsConfig, err := newTLSConfig(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	mechanism, err := newSASLMechanism(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return tlsConfig, mechanism, nil
+}
+
+// Без CA файла сертификат брокера проверяется системными корневыми сертификатами
+func newTLSConfig(cfg configs.Kafka) (*tls.Config, error) {
+	if !cfg.TLSEnabled {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if cfg.TLSCAFile != "" {
+		caPEM, err := os.ReadFile(cfg.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read kafka CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("kafka CA file %s contains no PEM certificates", cfg.TLSCAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.TLSCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load kafka client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+func newSASLMechanism(cfg configs.Kafka) (sasl.Mechanism, error) {
+	var algo scram.Algorithm
+	switch cfg.SASLMechanism {
+	case "":
+		return nil, nil
+	case configs.SASLScramSHA256:
+		algo = scram.SHA256
+	case configs.SASLScramSHA512:
+		algo = scram.SHA512
+	default:
+		return nil, fmt.Errorf("unsupported kafka SASL mechanism %q", cfg.SASLMechanism)
+	}
+
+	mechanism, err := scram.Mechanism(algo, cfg.SASLUsername, cfg.SASLPassword)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kafka SASL mechanism: %w", err)
+	}
+	return mechanism, nil
+}
+
+func groupBalancers(cfg configs.Kafka) []kafka.GroupBalancer {
+	if cfg.RebalanceStrategy == configs.RebalanceRoundRobin {
+		return []kafka.GroupBalancer{kafka.RoundRobinGroupBalancer{}}
+	}
+	return []kafka.GroupBalancer{kafka.RangeGroupBalancer{}}
+}
+
+func startOffset(cfg configs.Kafka) int64 {
+	if cfg.StartOffset == configs.StartOffsetLatest {
+		return kafka.LastOffset
+	}
+	return kafka.FirstOffset
+}
@@ -0,0 +1,95 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"orders-service/internal/app/model"
+	"orders-service/internal/configs"
+	"orders-service/internal/source"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Заголовки, которые добавляются к сообщению при отправке в dead-letter топик
+const (
+	HeaderFailureKind       = "x-failure-kind"
+	HeaderFailureReason     = "x-failure-reason"
+	HeaderOriginalTopic     = "x-original-topic"
+	HeaderOriginalPartition = "x-original-partition"
+	HeaderOriginalOffset    = "x-original-offset"
+	HeaderAttemptCount      = "x-attempt-count"
+	HeaderFailedAt          = "x-failed-at"
+	// JSON массив нарушений, если сообщение не прошло проверку
+	HeaderValidationErrors = "x-validation-errors"
+)
+
+type DeadLetterWriter struct {
+	writer *kafka.Writer
+}
+
+func NewDeadLetterWriter(cfg configs.Kafka) (*DeadLetterWriter, error) {
+	transport, err := newTransport(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DeadLetterWriter{
+		writer: &kafka.Writer{
+			Addr:                   kafka.TCP(cfg.Brokers...),
+			Topic:                  cfg.DLQTopic,
+			Transport:              transport,
+			Balancer:               &kafka.Hash{},
+			RequiredAcks:           kafka.RequireAll,
+			BatchSize:              1,
+			AllowAutoTopicCreation: true,
+		},
+	}, nil
+}
+
+// Публикует исходное сообщение в dead-letter топик
+func (w *DeadLetterWriter) Publish(ctx context.Context, m source.Message, kind string, cause error, attempts int) error {
+	msg, err := deadLetterMessage(m, kind, cause, attempts, time.Now())
+	if err != nil {
+		return err
+	}
+	return w.writer.WriteMessages(ctx, msg)
+}
+
+// Сохраняет ключ, тело и заголовки исходного сообщения и дописывает заголовки
+// с причиной ошибки и координатами исходного сообщения
+func deadLetterMessage(m source.Message, kind string, cause error, attempts int, failedAt time.Time) (kafka.Message, error) {
+	headers := make([]kafka.Header, 0, len(m.Headers)+8)
+	for _, h := range m.Headers {
+		headers = append(headers, kafka.Header{Key: h.Key, Value: h.Value})
+	}
+	headers = append(headers,
+		kafka.Header{Key: HeaderFailureKind, Value: []byte(kind)},
+		kafka.Header{Key: HeaderFailureReason, Value: []byte(cause.Error())},
+		kafka.Header{Key: HeaderOriginalTopic, Value: []byte(m.Topic)},
+		kafka.Header{Key: HeaderOriginalPartition, Value: []byte(strconv.Itoa(m.Partition))},
+		kafka.Header{Key: HeaderOriginalOffset, Value: []byte(strconv.FormatInt(m.Offset, 10))},
+		kafka.Header{Key: HeaderAttemptCount, Value: []byte(strconv.Itoa(attempts))},
+		kafka.Header{Key: HeaderFailedAt, Value: []byte(failedAt.UTC().Format(time.RFC3339Nano))},
+	)
+	if violations := model.Violations(cause); violations != nil {
+		data, err := json.Marshal(violations)
+		if err != nil {
+			return kafka.Message{}, fmt.Errorf("failed to marshal validation errors: %w", err)
+		}
+		headers = append(headers, kafka.Header{Key: HeaderValidationErrors, Value: data})
+	}
+
+	return kafka.Message{
+		Key:     m.Key,
+		Value:   m.Value,
+		Headers: headers,
+	}, nil
+}
+
+func (w *DeadLetterWriter) Close() error {
+	return w.writer.Close()
+}
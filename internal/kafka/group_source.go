@@ -0,0 +1,203 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"orders-service/internal/configs"
+	"orders-service/internal/source"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Пауза перед повторным чтением оффсетов или сообщений партиции после ошибки
+const partitionRetryDelay = time.Second
+
+// Хранилище оффсетов, в которое консьюмер сохраняет их вместе с результатом обработки
+type OffsetStore interface {
+	GetOffsets(ctx context.Context, groupID, topic string) (map[int]int64, error)
+}
+
+// Источник заказов из топиков Kafka, оффсеты которого хранятся не в брокере, а в OffsetStore.
+// Распределением партиций по-прежнему занимается consumer group, но после каждого ребаланса
+// назначенные партиции читаются с оффсетов из хранилища. Партиции, для которых оффсета
+// в хранилище еще нет, читаются с оффсета, закоммиченного группой в брокере
+type GroupSource struct {
+	group    *kafka.ConsumerGroup
+	store    OffsetStore
+	cfg      configs.Kafka
+	dialer   *kafka.Dialer
+	groupID  string
+	messages chan source.Message
+	errs     chan error
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+func NewGroupSource(cfg configs.Kafka, store OffsetStore) (*GroupSource, error) {
+	dialer, err := newDialer(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	group, err := kafka.NewConsumerGroup(kafka.ConsumerGroupConfig{
+		ID:             cfg.GroupID,
+		Brokers:        cfg.Brokers,
+		Topics:         cfg.TopicNames(),
+		Dialer:         dialer,
+		SessionTimeout: cfg.SessionTimeout,
+		GroupBalancers: groupBalancers(cfg),
+		StartOffset:    startOffset(cfg),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create consumer group: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &GroupSource{
+		group:    group,
+		store:    store,
+		cfg:      cfg,
+		dialer:   dialer,
+		groupID:  cfg.GroupID,
+		messages: make(chan source.Message),
+		errs:     make(chan error),
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+	go s.run(ctx)
+
+	return s, nil
+}
+
+func (s *GroupSource) Fetch(ctx context.Context) (source.Message, error) {
+	select {
+	case m := <-s.messages:
+		return m, nil
+	case err := <-s.errs:
+		return source.Message{}, err
+	case <-s.done:
+		return source.Message{}, source.ErrExhausted
+	case <-ctx.Done():
+		return source.Message{}, ctx.Err()
+	}
+}
+
+// Оффсеты уже сохранены в хранилище вместе с результатом обработки, в брокер они не коммитятся
+func (s *GroupSource) Commit(ctx context.Context, msgs ...source.Message) error {
+	return nil
+}
+
+func (s *GroupSource) Close() error {
+	s.cancel()
+	err := s.group.Close()
+	<-s.done
+	return err
+}
+
+// Получает поколения группы одно за другим. Поколение заканчивается при ребалансе,
+// после чего партиции назначаются заново
+func (s *GroupSource) run(ctx context.Context) {
+	defer close(s.done)
+
+	for {
+		gen, err := s.group.Next(ctx)
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, kafka.ErrGroupClosed) {
+				return
+			}
+			s.reportError(ctx, fmt.Errorf("failed to join consumer group: %w", err))
+			continue
+		}
+
+		for topic, assignments := range gen.Assignments {
+			for _, assignment := range assignments {
+				gen.Start(func(genCtx context.Context) {
+					s.readPartition(genCtx, topic, assignment)
+				})
+			}
+		}
+	}
+}
+
+// Читает назначенную партицию, пока не закончится поколение
+func (s *GroupSource) readPartition(ctx context.Context, topic string, assignment kafka.PartitionAssignment) {
+	offset, err := s.startOffset(ctx, topic, assignment)
+	if err != nil {
+		return
+	}
+
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:   s.cfg.Brokers,
+		Topic:     topic,
+		Partition: assignment.ID,
+		Dialer:    s.dialer,
+		MinBytes:  s.cfg.MinBytes,
+		MaxBytes:  s.cfg.MaxBytes,
+		MaxWait:   s.cfg.MaxWait,
+	})
+	defer reader.Close()
+
+	if err := reader.SetOffset(offset); err != nil {
+		s.reportError(ctx, fmt.Errorf("failed to seek partition %s/%d to offset %d: %w", topic, assignment.ID, offset, err))
+		return
+	}
+
+	for {
+		m, err := reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			s.reportError(ctx, fmt.Errorf("failed to fetch message from partition %s/%d: %w", topic, assignment.ID, err))
+			if !sleep(ctx, partitionRetryDelay) {
+				return
+			}
+			continue
+		}
+
+		select {
+		case s.messages <- fromKafkaMessage(m):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Возвращает оффсет из хранилища, а если его там нет - оффсет группы в брокере.
+// Без оффсета читать партицию нельзя, поэтому ошибки хранилища повторяются до конца поколения
+func (s *GroupSource) startOffset(ctx context.Context, topic string, assignment kafka.PartitionAssignment) (int64, error) {
+	for {
+		offsets, err := s.store.GetOffsets(ctx, s.groupID, topic)
+		if err == nil {
+			if offset, ok := offsets[assignment.ID]; ok {
+				return offset, nil
+			}
+			return assignment.Offset, nil
+		}
+
+		s.reportError(ctx, fmt.Errorf("failed to load stored offset of partition %s/%d: %w", topic, assignment.ID, err))
+		if !sleep(ctx, partitionRetryDelay) {
+			return 0, ctx.Err()
+		}
+	}
+}
+
+// Передает ошибку консьюмеру через Fetch
+func (s *GroupSource) reportError(ctx context.Context, err error) {
+	select {
+	case s.errs <- err:
+	case <-ctx.Done():
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
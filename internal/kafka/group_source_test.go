@@ -0,0 +1,82 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"orders-service/internal/source"
+
+	"github.com/segmentio/kafka-go"
+)
+
+type fakeOffsetStore struct {
+	offsets map[int]int64
+	err     error
+}
+
+func (s *fakeOffsetStore) GetOffsets(_ context.Context, groupID, topic string) (map[int]int64, error) {
+	if groupID != "orders-service" || topic != "orders" {
+		return nil, errors.New("unexpected group or topic")
+	}
+	return s.offsets, s.err
+}
+
+func newTestGroupSource(store OffsetStore) *GroupSource {
+	return &GroupSource{
+		store:    store,
+		groupID:  "orders-service",
+		messages: make(chan source.Message),
+		errs:     make(chan error),
+		done:     make(chan struct{}),
+	}
+}
+
+func TestGroupSourceStartOffset(t *testing.T) {
+	s := newTestGroupSource(&fakeOffsetStore{offsets: map[int]int64{0: 42}})
+
+	// Партиция читается с оффсета из хранилища, а без него - с оффсета группы в брокере
+	offset, err := s.startOffset(context.Background(), "orders", kafka.PartitionAssignment{ID: 0, Offset: 10})
+	if err != nil || offset != 42 {
+		t.Errorf("stored partition start = %d, %v, want 42", offset, err)
+	}
+	offset, err = s.startOffset(context.Background(), "orders", kafka.PartitionAssignment{ID: 1, Offset: 10})
+	if err != nil || offset != 10 {
+		t.Errorf("new partition start = %d, %v, want group offset 10", offset, err)
+	}
+}
+
+func TestGroupSourceReportsStoreError(t *testing.T) {
+	storeErr := errors.New("connection refused")
+	s := newTestGroupSource(&fakeOffsetStore{err: storeErr})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	type result struct {
+		offset int64
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		offset, err := s.startOffset(ctx, "orders", kafka.PartitionAssignment{ID: 0, Offset: 10})
+		done <- result{offset, err}
+	}()
+
+	// Без оффсета из хранилища партиция не читается с оффсета брокера,
+	// а ошибка доходит до консьюмера через Fetch
+	if _, err := s.Fetch(context.Background()); !errors.Is(err, storeErr) {
+		t.Fatalf("Fetch error = %v, want store error", err)
+	}
+
+	// Конец поколения прекращает повторы
+	cancel()
+	select {
+	case res := <-done:
+		if !errors.Is(res.err, context.Canceled) {
+			t.Errorf("startOffset = %d, %v after generation end, want context.Canceled", res.offset, res.err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("startOffset did not stop after generation end")
+	}
+}
@@ -0,0 +1,151 @@
+package kafka
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"orders-service/internal/app/model"
+	"orders-service/internal/codec"
+	"orders-service/internal/configs"
+	"orders-service/internal/source"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func headerMap(headers []kafka.Header) map[string]string {
+	m := make(map[string]string, len(headers))
+	for _, h := range headers {
+		m[h.Key] = string(h.Value)
+	}
+	return m
+}
+
+func TestDeadLetterMessage(t *testing.T) {
+	m := source.Message{
+		Topic:     "orders",
+		Partition: 2,
+		Offset:    41,
+		Key:       []byte("order-1"),
+		Value:     []byte(`{"order_uid": "order-1"}`),
+		Headers:   []source.Header{{Key: codec.HeaderContentType, Value: []byte(codec.ContentTypeJSON)}},
+	}
+	verr := &model.ValidationError{}
+	verr.Add(model.ViolationRequired, "items list cannot be empty", "items")
+	cause := fmt.Errorf("invalid order: %w", verr)
+	failedAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.FixedZone("MSK", 3*60*60))
+
+	msg, err := deadLetterMessage(m, "validation", cause, 3, failedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(msg.Key) != "order-1" || string(msg.Value) != string(m.Value) {
+		t.Errorf("key/value = %q/%q, want original", msg.Key, msg.Value)
+	}
+
+	headers := headerMap(msg.Headers)
+	want := map[string]string{
+		codec.HeaderContentType: codec.ContentTypeJSON,
+		HeaderFailureKind:       "validation",
+		HeaderFailureReason:     cause.Error(),
+		HeaderOriginalTopic:     "orders",
+		HeaderOriginalPartition: "2",
+		HeaderOriginalOffset:    "41",
+		HeaderAttemptCount:      "3",
+		HeaderFailedAt:          "2024-03-01T09:00:00Z",
+	}
+	for key, value := range want {
+		if headers[key] != value {
+			t.Errorf("header %s = %q, want %q", key, headers[key], value)
+		}
+	}
+
+	var violations []model.Violation
+	if err := json.Unmarshal([]byte(headers[HeaderValidationErrors]), &violations); err != nil {
+		t.Fatalf("validation errors header: %v", err)
+	}
+	if len(violations) != 1 || violations[0].Path != "/items" {
+		t.Errorf("violations = %+v", violations)
+	}
+
+	msg, err = deadLetterMessage(m, "retries_exhausted", errors.New("timeout"), 5, failedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := headerMap(msg.Headers)[HeaderValidationErrors]; ok {
+		t.Error("validation errors header is set for an error without violations")
+	}
+}
+
+func TestOutboxMessage(t *testing.T) {
+	msg := outboxMessage(&model.OutboxMessage{
+		OrderUID:  "order-1",
+		EventType: model.EventOrderPersisted,
+		Payload:   []byte(`{"order_uid": "order-1"}`),
+	})
+
+	if string(msg.Key) != "order-1" {
+		t.Errorf("key = %q, want order_uid", msg.Key)
+	}
+	headers := headerMap(msg.Headers)
+	if headers[HeaderEventType] != string(model.EventOrderPersisted) ||
+		headers[codec.HeaderContentType] != codec.ContentTypeJSON ||
+		headers[codec.HeaderSchemaVersion] != "1" {
+		t.Errorf("headers = %v", headers)
+	}
+}
+
+func TestFromKafkaMessage(t *testing.T) {
+	now := time.Now()
+	m := fromKafkaMessage(kafka.Message{
+		Topic:         "orders",
+		Partition:     1,
+		Offset:        10,
+		HighWaterMark: 12,
+		Key:           []byte("k"),
+		Value:         []byte("v"),
+		Headers:       []kafka.Header{{Key: "a", Value: []byte("b")}},
+		Time:          now,
+	})
+
+	if m.Topic != "orders" || m.Partition != 1 || m.Offset != 10 || m.HighWaterMark != 12 ||
+		string(m.Key) != "k" || string(m.Value) != "v" || !m.Time.Equal(now) {
+		t.Errorf("message = %+v", m)
+	}
+	if len(m.Headers) != 1 || m.Headers[0].Key != "a" || string(m.Headers[0].Value) != "b" {
+		t.Errorf("headers = %+v", m.Headers)
+	}
+}
+
+func TestSecuritySettings(t *testing.T) {
+	if tlsConfig, err := newTLSConfig(configs.Kafka{}); tlsConfig != nil || err != nil {
+		t.Errorf("TLS disabled: config = %v, err = %v", tlsConfig, err)
+	}
+	if _, err := newTLSConfig(configs.Kafka{TLSEnabled: true, TLSCAFile: "testdata/missing.pem"}); err == nil {
+		t.Error("missing CA file is accepted")
+	}
+
+	for _, mechanism := range []string{configs.SASLScramSHA256, configs.SASLScramSHA512} {
+		m, err := newSASLMechanism(configs.Kafka{SASLMechanism: mechanism, SASLUsername: "user", SASLPassword: "secret"})
+		if err != nil || m == nil || m.Name() != mechanism {
+			t.Errorf("%s: mechanism = %v, err = %v", mechanism, m, err)
+		}
+	}
+	if _, err := newSASLMechanism(configs.Kafka{SASLMechanism: "PLAIN"}); err == nil {
+		t.Error("unsupported SASL mechanism is accepted")
+	}
+}
+
+func TestOutboxWriterDoesNotWaitForBatch(t *testing.T) {
+	w, err := NewOutboxWriter(configs.Kafka{Brokers: []string{"localhost:9092"}}, configs.Outbox{Topic: "order-events", BatchSize: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	if w.writer.BatchSize != 50 || w.writer.BatchTimeout != outboxBatchTimeout {
+		t.Errorf("batch size = %d, timeout = %v", w.writer.BatchSize, w.writer.BatchTimeout)
+	}
+}
@@ -0,0 +1,87 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"orders-service/internal/app/model"
+	"orders-service/internal/codec"
+	"orders-service/internal/configs"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Заголовок с типом исходящего события
+const HeaderEventType = "event-type"
+
+// Сколько writer ждет добора порции. Relay публикует уже собранную порцию,
+// поэтому ждать добора по умолчанию (1s) незачем
+const outboxBatchTimeout = 10 * time.Millisecond
+
+// Публикует события из outbox. Ключ сообщения - order_uid, поэтому события
+// одного заказа попадают в одну партицию и читаются в порядке публикации
+type OutboxWriter struct {
+	writer *kafka.Writer
+}
+
+func NewOutboxWriter(cfg configs.Kafka, outbox configs.Outbox) (*OutboxWriter, error) {
+	transport, err := newTransport(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &OutboxWriter{
+		writer: &kafka.Writer{
+			Addr:                   kafka.TCP(cfg.Brokers...),
+			Topic:                  outbox.Topic,
+			Transport:              transport,
+			Balancer:               &kafka.Hash{},
+			RequiredAcks:           kafka.RequireAll,
+			BatchSize:              outbox.BatchSize,
+			BatchTimeout:           outboxBatchTimeout,
+			AllowAutoTopicCreation: true,
+		},
+	}, nil
+}
+
+// Публикует события одним запросом и возвращает ошибку для каждого из них
+func (w *OutboxWriter) Publish(ctx context.Context, msgs []*model.OutboxMessage) []error {
+	kafkaMsgs := make([]kafka.Message, 0, len(msgs))
+	for _, msg := range msgs {
+		kafkaMsgs = append(kafkaMsgs, outboxMessage(msg))
+	}
+
+	errs := make([]error, len(msgs))
+	err := w.writer.WriteMessages(ctx, kafkaMsgs...)
+
+	var writeErrs kafka.WriteErrors
+	switch {
+	case err == nil:
+	case errors.As(err, &writeErrs):
+		copy(errs, writeErrs)
+	default:
+		for i := range errs {
+			errs[i] = err
+		}
+	}
+
+	return errs
+}
+
+func outboxMessage(msg *model.OutboxMessage) kafka.Message {
+	return kafka.Message{
+		Key:   []byte(msg.OrderUID),
+		Value: msg.Payload,
+		Headers: []kafka.Header{
+			{Key: codec.HeaderContentType, Value: []byte(codec.ContentTypeJSON)},
+			{Key: codec.HeaderSchemaVersion, Value: []byte(strconv.Itoa(1))},
+			{Key: HeaderEventType, Value: []byte(msg.EventType)},
+		},
+	}
+}
+
+func (w *OutboxWriter) Close() error {
+	return w.writer.Close()
+}
@@ -0,0 +1,169 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"orders-service/internal/configs"
+	"orders-service/internal/replay"
+	"orders-service/internal/source"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Временный читатель партиций топиков для воспроизведения истории. Он не входит
+// в consumer group и не коммитит оффсеты, поэтому не мешает основному консьюмеру
+type ReplayReader struct {
+	cfg    configs.Kafka
+	dialer *kafka.Dialer
+}
+
+func NewReplayReader(cfg configs.Kafka) (*ReplayReader, error) {
+	dialer, err := newDialer(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ReplayReader{cfg: cfg, dialer: dialer}, nil
+}
+
+func (r *ReplayReader) Partitions(ctx context.Context, topic string) ([]int, error) {
+	var partitions []kafka.Partition
+	err := r.eachBroker(func(broker string) error {
+		var err error
+		partitions, err = r.dialer.LookupPartitions(ctx, "tcp", broker, topic)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int, 0, len(partitions))
+	for _, p := range partitions {
+		ids = append(ids, p.ID)
+	}
+	slices.Sort(ids)
+	return ids, nil
+}
+
+// Читает партицию от from до оффсета, который был последним на момент начала чтения.
+// Оффсет за пределами партиции приводится к ее границам, а время - к первому
+// сообщению, записанному не раньше него
+func (r *ReplayReader) ReadPartition(ctx context.Context, topic string, partition int, from replay.Position, fn func(m source.Message) error) (replay.Range, error) {
+	rng, err := r.resolveRange(ctx, topic, partition, from)
+	if err != nil || rng.Start >= rng.End {
+		return rng, err
+	}
+
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:   r.cfg.Brokers,
+		Topic:     topic,
+		Partition: partition,
+		Dialer:    r.dialer,
+		MinBytes:  r.cfg.MinBytes,
+		MaxBytes:  r.cfg.MaxBytes,
+		MaxWait:   r.cfg.MaxWait,
+	})
+	defer reader.Close()
+
+	if err := reader.SetOffset(rng.Start); err != nil {
+		return rng, fmt.Errorf("failed to seek partition %d to offset %d: %w", partition, rng.Start, err)
+	}
+
+	err = readRange(ctx, reader, partition, rng, 2*max(r.cfg.MaxWait, time.Second), fn)
+	if errors.Is(err, errNoMoreMessages) {
+		// Хвост диапазона занят служебными записями или удален компактизацией,
+		// сообщений до End больше не будет. Убеждаемся, что партиция доступна,
+		// а не просто молчит из-за недоступного брокера
+		if _, err := r.resolveRange(ctx, topic, partition, replay.Position{}); err != nil {
+			return rng, fmt.Errorf("partition %d stopped returning messages: %w", partition, err)
+		}
+		return rng, nil
+	}
+	return rng, err
+}
+
+// Признак того, что читатель дольше idle не отдает сообщений до конца диапазона
+var errNoMoreMessages = errors.New("no more messages in range")
+
+type partitionReader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+}
+
+// Передает в fn сообщения диапазона rng. Служебные записи транзакций и удаленные
+// компактизацией оффсеты читатель не отдает, поэтому последнего оффсета диапазона
+// может не быть: если за idle не пришло ни одного сообщения, возвращается errNoMoreMessages
+func readRange(ctx context.Context, reader partitionReader, partition int, rng replay.Range, idle time.Duration, fn func(m source.Message) error) error {
+	for {
+		fetchCtx, cancel := context.WithTimeout(ctx, idle)
+		m, err := reader.FetchMessage(fetchCtx)
+		cancel()
+		switch {
+		case err != nil && ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded):
+			return errNoMoreMessages
+		case err != nil:
+			return fmt.Errorf("failed to fetch message from partition %d: %w", partition, err)
+		case m.Offset >= rng.End:
+			return nil
+		}
+
+		if err := fn(fromKafkaMessage(m)); err != nil {
+			return err
+		}
+		if m.Offset+1 >= rng.End {
+			return nil
+		}
+	}
+}
+
+func (r *ReplayReader) resolveRange(ctx context.Context, topic string, partition int, from replay.Position) (replay.Range, error) {
+	var rng replay.Range
+	err := r.eachBroker(func(broker string) error {
+		conn, err := r.dialer.DialLeader(ctx, "tcp", broker, topic, partition)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		first, last, err := conn.ReadOffsets()
+		if err != nil {
+			return fmt.Errorf("failed to read offsets of partition %d: %w", partition, err)
+		}
+
+		start := first
+		switch {
+		case from.Offset != nil:
+			start = *from.Offset
+		case from.Timestamp != nil:
+			start, err = conn.ReadOffset(*from.Timestamp)
+			if err != nil {
+				return fmt.Errorf("failed to find offset of partition %d at %s: %w", partition, from.Timestamp, err)
+			}
+		}
+		// Для времени позже последнего сообщения брокер возвращает отрицательный оффсет
+		if start < 0 || start > last {
+			start = last
+		}
+
+		rng = replay.Range{Start: max(start, first), End: last}
+		return nil
+	})
+
+	return rng, err
+}
+
+// Выполняет fn с адресами брокеров по очереди, пока один из вызовов не пройдет
+func (r *ReplayReader) eachBroker(fn func(broker string) error) error {
+	var errs []error
+	for _, broker := range r.cfg.Brokers {
+		err := fn(broker)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", broker, err))
+	}
+	return errors.Join(errs...)
+}
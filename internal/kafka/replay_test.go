@@ -0,0 +1,69 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"orders-service/internal/replay"
+	"orders-service/internal/source"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Читатель, который отдает заданные оффсеты, а потом ждет новых сообщений, как kafka.Reader
+type fakePartitionReader struct {
+	offsets []int64
+}
+
+func (r *fakePartitionReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	if len(r.offsets) == 0 {
+		<-ctx.Done()
+		return kafka.Message{}, ctx.Err()
+	}
+	offset := r.offsets[0]
+	r.offsets = r.offsets[1:]
+	return kafka.Message{Offset: offset}, nil
+}
+
+func readOffsets(ctx context.Context, offsets []int64, rng replay.Range) ([]int64, error) {
+	var read []int64
+	err := readRange(ctx, &fakePartitionReader{offsets: offsets}, 0, rng, 10*time.Millisecond, func(m source.Message) error {
+		read = append(read, m.Offset)
+		return nil
+	})
+	return read, err
+}
+
+func TestReadRange(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		offsets []int64
+		rng     replay.Range
+		want    []int64
+		err     error
+	}{
+		{"stops at last offset", []int64{3, 4, 5, 6}, replay.Range{Start: 3, End: 6}, []int64{3, 4, 5}, nil},
+		{"skips gaps", []int64{3, 5, 7}, replay.Range{Start: 3, End: 6}, []int64{3, 5}, nil},
+		{"trailing control records", []int64{3, 4}, replay.Range{Start: 3, End: 6}, []int64{3, 4}, errNoMoreMessages},
+		{"no messages in range", nil, replay.Range{Start: 3, End: 6}, nil, errNoMoreMessages},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			read, err := readOffsets(context.Background(), tc.offsets, tc.rng)
+			if !errors.Is(err, tc.err) || !slices.Equal(read, tc.want) {
+				t.Errorf("read %v, err = %v, want %v, %v", read, err, tc.want, tc.err)
+			}
+		})
+	}
+}
+
+func TestReadRangeStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := readOffsets(ctx, nil, replay.Range{Start: 0, End: 1}); !errors.Is(err, context.Canceled) || errors.Is(err, errNoMoreMessages) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,77 @@
+package kafka
+
+import (
+	"context"
+
+	"orders-service/internal/configs"
+	"orders-service/internal/source"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Источник заказов из топиков Kafka в составе consumer group
+type Source struct {
+	reader *kafka.Reader
+}
+
+func NewSource(cfg configs.Kafka) (*Source, error) {
+	dialer, err := newDialer(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Source{
+		reader: kafka.NewReader(kafka.ReaderConfig{
+			Brokers:        cfg.Brokers,
+			GroupTopics:    cfg.TopicNames(),
+			GroupID:        cfg.GroupID,
+			Dialer:         dialer,
+			MinBytes:       cfg.MinBytes,
+			MaxBytes:       cfg.MaxBytes,
+			MaxWait:        cfg.MaxWait,
+			SessionTimeout: cfg.SessionTimeout,
+			GroupBalancers: groupBalancers(cfg),
+			StartOffset:    startOffset(cfg),
+		}),
+	}, nil
+}
+
+func (s *Source) Fetch(ctx context.Context) (source.Message, error) {
+	m, err := s.reader.FetchMessage(ctx)
+	if err != nil {
+		return source.Message{}, err
+	}
+
+	return fromKafkaMessage(m), nil
+}
+
+func (s *Source) Commit(ctx context.Context, msgs ...source.Message) error {
+	kafkaMsgs := make([]kafka.Message, 0, len(msgs))
+	for _, m := range msgs {
+		kafkaMsgs = append(kafkaMsgs, kafka.Message{Topic: m.Topic, Partition: m.Partition, Offset: m.Offset})
+	}
+
+	return s.reader.CommitMessages(ctx, kafkaMsgs...)
+}
+
+func (s *Source) Close() error {
+	return s.reader.Close()
+}
+
+func fromKafkaMessage(m kafka.Message) source.Message {
+	headers := make([]source.Header, 0, len(m.Headers))
+	for _, h := range m.Headers {
+		headers = append(headers, source.Header{Key: h.Key, Value: h.Value})
+	}
+
+	return source.Message{
+		Topic:         m.Topic,
+		Partition:     m.Partition,
+		Offset:        m.Offset,
+		HighWaterMark: m.HighWaterMark,
+		Key:           m.Key,
+		Value:         m.Value,
+		Headers:       headers,
+		Time:          m.Time,
+	}
+}
@@ -0,0 +1,120 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"orders-service/internal/app/model"
+	"orders-service/internal/backoff"
+	"orders-service/internal/configs"
+
+	"go.uber.org/zap"
+)
+
+// Хранилище событий, записанных в одной транзакции с заказами
+type Store interface {
+	ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]*model.OutboxMessage, error)
+	CompleteOutboxEvents(ctx context.Context, msgs []*model.OutboxMessage, errs []error,
+		retryDelay func(attempts int) time.Duration,
+	) error
+}
+
+// Получатель событий, например топик Kafka
+type Publisher interface {
+	Publish(ctx context.Context, msgs []*model.OutboxMessage) []error
+	Close() error
+}
+
+// Фоновая публикация событий из outbox. Событие публикуется не раньше, чем зафиксирована
+// транзакция с заказом, и повторяется, пока публикация не удастся. Если публикация прошла,
+// а отметка об этом не сохранилась, событие будет опубликовано повторно.
+// Забранные события закрепляются за relay на lease, поэтому несколько экземпляров сервиса
+// публикуют разные события, не нарушая порядок событий одного заказа
+type Relay struct {
+	store        Store
+	publisher    Publisher
+	logger       *zap.Logger
+	pollInterval time.Duration
+	batchSize    int
+	lease        time.Duration
+	retry        backoff.Exponential
+}
+
+func NewRelay(cfg configs.Outbox, store Store, publisher Publisher, logger *zap.Logger) *Relay {
+	return &Relay{
+		store:        store,
+		publisher:    publisher,
+		logger:       logger,
+		pollInterval: cfg.PollInterval,
+		batchSize:    cfg.BatchSize,
+		lease:        cfg.Lease,
+		retry:        backoff.Exponential{Initial: cfg.RetryInitialBackoff, Max: cfg.RetryMaxBackoff},
+	}
+}
+
+// Публикует события, пока не отменен контекст. Полная порция забирается сразу
+// следующей, иначе relay ждет pollInterval
+func (r *Relay) Start(ctx context.Context) {
+	r.logger.Info("Outbox relay started",
+		zap.Duration("poll_interval", r.pollInterval),
+		zap.Int("batch_size", r.batchSize),
+		zap.Duration("lease", r.lease),
+	)
+
+	for {
+		n, err := r.relay(ctx)
+		if err != nil && ctx.Err() == nil {
+			r.logger.Error("Failed to relay outbox events", zap.Error(err))
+		}
+
+		if n < r.batchSize || err != nil {
+			select {
+			case <-ctx.Done():
+				r.logger.Info("Context cancelled, shutting down outbox relay...")
+				return
+			case <-time.After(r.pollInterval):
+			}
+		}
+	}
+}
+
+func (r *Relay) Close() error {
+	return r.publisher.Close()
+}
+
+// Забирает порцию событий, публикует ее вне транзакции и сохраняет результат.
+// Публикация ограничена арендой, чтобы события не ушли после того, как их забрал другой relay
+func (r *Relay) relay(ctx context.Context) (int, error) {
+	msgs, err := r.store.ClaimOutboxEvents(ctx, r.batchSize, r.lease)
+	if err != nil || len(msgs) == 0 {
+		return 0, err
+	}
+
+	publishCtx, cancel := context.WithTimeout(ctx, r.lease)
+	errs := r.publish(publishCtx, msgs)
+	cancel()
+
+	return len(msgs), r.store.CompleteOutboxEvents(ctx, msgs, errs, r.retry.Delay)
+}
+
+func (r *Relay) publish(ctx context.Context, msgs []*model.OutboxMessage) []error {
+	errs := r.publisher.Publish(ctx, msgs)
+
+	published := 0
+	for i, err := range errs {
+		if err == nil {
+			published++
+			continue
+		}
+		r.logger.Warn("Failed to publish outbox event, will retry",
+			zap.Error(err),
+			zap.Int64("outbox_id", msgs[i].ID),
+			zap.String("order_uid", msgs[i].OrderUID),
+			zap.String("event_type", string(msgs[i].EventType)),
+			zap.Int("attempt", msgs[i].Attempts+1),
+		)
+	}
+	r.logger.Info("Outbox events published", zap.Int("published", published), zap.Int("failed", len(msgs)-published))
+
+	return errs
+}
@@ -0,0 +1,303 @@
+package replay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"orders-service/internal/app/model"
+	"orders-service/internal/app/service"
+	"orders-service/internal/codec"
+	"orders-service/internal/source"
+
+	"go.uber.org/zap"
+)
+
+// Сколько ошибок отдельных сообщений попадает в отчет
+const maxReportedErrors = 100
+
+var (
+	// Запрос на воспроизведение заполнен неверно
+	ErrInvalidRequest = errors.New("invalid replay request")
+	// Предыдущее воспроизведение еще не закончилось
+	ErrInProgress = errors.New("replay is already in progress")
+)
+
+// Начало воспроизведения партиции: оффсет или время сообщения, задается что-то одно
+type Position struct {
+	Offset    *int64     `json:"offset,omitempty"`
+	Timestamp *time.Time `json:"timestamp,omitempty"`
+}
+
+// Оффсеты, которые читаются из партиции: [Start, End)
+type Range struct {
+	Start int64
+	End   int64
+}
+
+// Временный читатель топиков с заказами, не связанный с consumer group
+type Reader interface {
+	Partitions(ctx context.Context, topic string) ([]int, error)
+	// Читает партицию с позиции from до конца партиции на момент начала чтения
+	ReadPartition(ctx context.Context, topic string, partition int, from Position, fn func(m source.Message) error) (Range, error)
+}
+
+// Методы сервиса заказов, которые нужны для воспроизведения
+type OrderService interface {
+	SaveOrder(ctx context.Context, order *model.Order) (model.SaveOutcome, error)
+	CheckOrder(ctx context.Context, order *model.Order) (model.SaveOutcome, error)
+}
+
+type PartitionRequest struct {
+	Partition int `json:"partition"`
+	Position
+}
+
+type Request struct {
+	// Топик можно не указывать, если сервис читает один топик
+	Topic      string             `json:"topic,omitempty"`
+	Partitions []PartitionRequest `json:"partitions"`
+	// Начало для всех партиций топика, которых нет в Partitions
+	From *Position `json:"from,omitempty"`
+	// Проверить заказы и посчитать результат, ничего не сохраняя
+	DryRun bool `json:"dry_run"`
+}
+
+type Counts struct {
+	Messages  int `json:"messages"`
+	Inserted  int `json:"inserted"`
+	Duplicate int `json:"duplicate"`
+	Failed    int `json:"failed"`
+	// Сообщения с событиями, отличными от order.created
+	Skipped int `json:"skipped"`
+}
+
+type PartitionReport struct {
+	Partition   int   `json:"partition"`
+	StartOffset int64 `json:"start_offset"`
+	EndOffset   int64 `json:"end_offset"`
+	Counts
+	// Чтение партиции прервано этой ошибкой
+	Error string `json:"error,omitempty"`
+}
+
+type MessageError struct {
+	Partition        int               `json:"partition"`
+	Offset           int64             `json:"offset"`
+	OrderUID         string            `json:"order_uid,omitempty"`
+	Error            string            `json:"error"`
+	ValidationErrors []model.Violation `json:"validation_errors,omitempty"`
+}
+
+type Report struct {
+	Topic  string `json:"topic"`
+	DryRun bool   `json:"dry_run"`
+	Counts
+	Partitions []PartitionReport `json:"partitions"`
+	// Первые maxReportedErrors ошибок отдельных сообщений
+	Errors []MessageError `json:"errors,omitempty"`
+}
+
+// Повторно сохраняет заказы из истории топика. Сохранение идемпотентно, поэтому
+// уже сохраненные заказы считаются дубликатами, а воспроизведение можно повторять
+type Replayer struct {
+	reader  Reader
+	topics  []string
+	decoder *codec.Registry
+	service OrderService
+	logger  *zap.Logger
+	running sync.Mutex
+}
+
+// topics - топики, которые читает консьюмер: воспроизводить можно только их
+func NewReplayer(reader Reader, topics []string, decoder *codec.Registry, svc OrderService, logger *zap.Logger) *Replayer {
+	return &Replayer{
+		reader:  reader,
+		topics:  topics,
+		decoder: decoder,
+		service: svc,
+		logger:  logger,
+	}
+}
+
+// Воспроизводит партиции по очереди. Ошибка чтения партиции записывается в ее отчет
+// и не останавливает остальные партиции
+func (r *Replayer) Replay(ctx context.Context, req Request) (*Report, error) {
+	if !r.running.TryLock() {
+		return nil, ErrInProgress
+	}
+	defer r.running.Unlock()
+
+	topic, partitions, err := r.plan(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	r.logger.Info("Replay started",
+		zap.String("topic", topic),
+		zap.Int("partitions", len(partitions)),
+		zap.Bool("dry_run", req.DryRun),
+	)
+
+	// Заказы проверяются так же, как при чтении топика консьюмером
+	ctx = service.WithSourceTopic(ctx, topic)
+
+	report := &Report{Topic: topic, DryRun: req.DryRun}
+	for _, p := range partitions {
+		pr := PartitionReport{Partition: p.Partition}
+
+		rng, err := r.reader.ReadPartition(ctx, topic, p.Partition, p.Position, func(m source.Message) error {
+			r.replayMessage(ctx, m, req.DryRun, &pr.Counts, report)
+			return nil
+		})
+		pr.StartOffset, pr.EndOffset = rng.Start, rng.End
+		if err != nil {
+			pr.Error = err.Error()
+			r.logger.Error("Replay of partition interrupted", zap.Error(err), zap.String("topic", topic), zap.Int("partition", p.Partition))
+		}
+
+		report.Partitions = append(report.Partitions, pr)
+		report.Messages += pr.Messages
+		report.Inserted += pr.Inserted
+		report.Duplicate += pr.Duplicate
+		report.Failed += pr.Failed
+		report.Skipped += pr.Skipped
+
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	r.logger.Info("Replay finished",
+		zap.String("topic", topic),
+		zap.Bool("dry_run", req.DryRun),
+		zap.Int("messages", report.Messages),
+		zap.Int("inserted", report.Inserted),
+		zap.Int("duplicate", report.Duplicate),
+		zap.Int("failed", report.Failed),
+		zap.Int("skipped", report.Skipped),
+	)
+
+	return report, nil
+}
+
+func (r *Replayer) replayMessage(ctx context.Context, m source.Message, dryRun bool, counts *Counts, report *Report) {
+	counts.Messages++
+
+	fail := func(orderUID string, err error) {
+		counts.Failed++
+		if len(report.Errors) < maxReportedErrors {
+			report.Errors = append(report.Errors, MessageError{
+				Partition:        m.Partition,
+				Offset:           m.Offset,
+				OrderUID:         orderUID,
+				Error:            err.Error(),
+				ValidationErrors: model.Violations(err),
+			})
+		}
+	}
+
+	event, _, err := r.decoder.DecodeMessage(m)
+	if err != nil {
+		fail("", err)
+		return
+	}
+	if event.Type != model.EventOrderCreated || event.Order == nil {
+		counts.Skipped++
+		return
+	}
+
+	var outcome model.SaveOutcome
+	if dryRun {
+		outcome, err = r.service.CheckOrder(ctx, event.Order)
+	} else {
+		outcome, err = r.service.SaveOrder(ctx, event.Order)
+	}
+	if err != nil {
+		fail(event.OrderUID, err)
+		return
+	}
+
+	if outcome == model.OrderDuplicate {
+		counts.Duplicate++
+	} else {
+		counts.Inserted++
+	}
+}
+
+// Проверяет запрос и возвращает топик и начало для каждой партиции, отсортированные по номеру
+func (r *Replayer) plan(ctx context.Context, req Request) (string, []PartitionRequest, error) {
+	topic, err := r.topic(req.Topic)
+	if err != nil {
+		return "", nil, err
+	}
+	partitions, err := r.planPartitions(ctx, topic, req)
+	return topic, partitions, err
+}
+
+func (r *Replayer) topic(topic string) (string, error) {
+	if topic == "" {
+		if len(r.topics) != 1 {
+			return "", fmt.Errorf("%w: topic is required, the service reads %d topics", ErrInvalidRequest, len(r.topics))
+		}
+		return r.topics[0], nil
+	}
+	if !slices.Contains(r.topics, topic) {
+		return "", fmt.Errorf("%w: topic %q is not read by the service", ErrInvalidRequest, topic)
+	}
+	return topic, nil
+}
+
+func (r *Replayer) planPartitions(ctx context.Context, topic string, req Request) ([]PartitionRequest, error) {
+	if len(req.Partitions) == 0 && req.From == nil {
+		return nil, fmt.Errorf("%w: neither partitions nor from is set", ErrInvalidRequest)
+	}
+
+	known, err := r.reader.Partitions(ctx, topic)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get partitions of topic %s: %w", topic, err)
+	}
+
+	seen := make(map[int]bool, len(req.Partitions))
+	partitions := make([]PartitionRequest, 0, len(known))
+	for _, p := range req.Partitions {
+		if !slices.Contains(known, p.Partition) {
+			return nil, fmt.Errorf("%w: partition %d does not exist", ErrInvalidRequest, p.Partition)
+		}
+		if seen[p.Partition] {
+			return nil, fmt.Errorf("%w: partition %d is listed twice", ErrInvalidRequest, p.Partition)
+		}
+		if err := p.Position.validate(); err != nil {
+			return nil, fmt.Errorf("%w: partition %d: %w", ErrInvalidRequest, p.Partition, err)
+		}
+		seen[p.Partition] = true
+		partitions = append(partitions, p)
+	}
+
+	if req.From != nil {
+		if err := req.From.validate(); err != nil {
+			return nil, fmt.Errorf("%w: from: %w", ErrInvalidRequest, err)
+		}
+		for _, id := range known {
+			if !seen[id] {
+				partitions = append(partitions, PartitionRequest{Partition: id, Position: *req.From})
+			}
+		}
+	}
+
+	slices.SortFunc(partitions, func(a, b PartitionRequest) int { return a.Partition - b.Partition })
+	return partitions, nil
+}
+
+func (p Position) validate() error {
+	switch {
+	case (p.Offset == nil) == (p.Timestamp == nil):
+		return errors.New("exactly one of offset and timestamp must be set")
+	case p.Offset != nil && *p.Offset < 0:
+		return fmt.Errorf("offset must not be negative, got %d", *p.Offset)
+	}
+	return nil
+}
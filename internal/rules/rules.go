@@ -0,0 +1,394 @@
+package rules
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+
+	"orders-service/internal/app/model"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Что делать с заказом, который нарушает правило
+const (
+	ModeReject = "reject"
+	ModeWarn   = "warn"
+)
+
+// Файл с правилами, YAML или JSON:
+//
+//	rules:
+//	  - field: /payment/currency
+//	    enum: [RUB, USD]
+//	  - field: /delivery/email
+//	    required: true
+//	    when: {field: /locale, equals: en}
+//	  - field: /items/*/price
+//	    min: 1
+//	    max: 1000000
+type file struct {
+	Rules []ruleSpec `yaml:"rules"`
+}
+
+type ruleSpec struct {
+	// JSON pointer поля заказа, * обозначает все элементы массива
+	Field    string   `yaml:"field"`
+	Required bool     `yaml:"required"`
+	Pattern  string   `yaml:"pattern"`
+	Enum     []any    `yaml:"enum"`
+	Min      *float64 `yaml:"min"`
+	Max      *float64 `yaml:"max"`
+	When     *when    `yaml:"when"`
+	// reject (по умолчанию) или warn
+	Mode string `yaml:"mode"`
+	// Код и описание нарушения вместо стандартных
+	Code    string `yaml:"code"`
+	Message string `yaml:"message"`
+}
+
+// Условие правила: правило проверяется, только если поле заказа Field
+// равно Equals, входит в In или, при Present, заполнено (или не заполнено)
+type when struct {
+	Field   string `yaml:"field"`
+	Equals  any    `yaml:"equals"`
+	In      []any  `yaml:"in"`
+	Present *bool  `yaml:"present"`
+}
+
+type rule struct {
+	field    []string
+	required bool
+	pattern  *regexp.Regexp
+	enum     map[string]bool
+	min, max *float64
+	when     *condition
+	warn     bool
+	code     string
+	message  string
+}
+
+type condition struct {
+	field   []string
+	values  map[string]bool
+	present *bool
+}
+
+// Набор проверенных правил из одного файла
+type Set struct {
+	rules    []rule
+	LoadedAt time.Time
+}
+
+func (s *Set) Len() int {
+	return len(s.rules)
+}
+
+// Читает и проверяет файл правил. Неизвестные ключи, неверные пути, регулярные
+// выражения и диапазоны считаются ошибкой, чтобы опечатка в файле не выключила правило молча
+func Load(path string) (*Set, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read validation rules %s: %w", path, err)
+	}
+
+	var f file
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&f); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse validation rules %s: %w", path, err)
+	}
+
+	set := &Set{LoadedAt: time.Now()}
+	for i, spec := range f.Rules {
+		r, err := compile(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid validation rule #%d (%s) in %s: %w", i+1, spec.Field, path, err)
+		}
+		set.rules = append(set.rules, r)
+	}
+
+	return set, nil
+}
+
+func compile(spec ruleSpec) (rule, error) {
+	field, err := model.ParseJSONPointer(spec.Field)
+	if err != nil {
+		return rule{}, err
+	}
+	if len(field) == 0 {
+		return rule{}, errors.New("field is required")
+	}
+
+	r := rule{
+		field:    field,
+		required: spec.Required,
+		min:      spec.Min,
+		max:      spec.Max,
+		code:     spec.Code,
+		message:  spec.Message,
+	}
+
+	if !spec.Required && spec.Pattern == "" && len(spec.Enum) == 0 && spec.Min == nil && spec.Max == nil {
+		return rule{}, errors.New("rule has no checks: set required, pattern, enum, min or max")
+	}
+	if spec.Pattern != "" {
+		if r.pattern, err = regexp.Compile(spec.Pattern); err != nil {
+			return rule{}, fmt.Errorf("invalid pattern: %w", err)
+		}
+	}
+	if len(spec.Enum) > 0 {
+		r.enum = valueSet(spec.Enum)
+	}
+	if spec.Min != nil && spec.Max != nil && *spec.Min > *spec.Max {
+		return rule{}, fmt.Errorf("min %v is greater than max %v", *spec.Min, *spec.Max)
+	}
+
+	switch spec.Mode {
+	case "", ModeReject:
+	case ModeWarn:
+		r.warn = true
+	default:
+		return rule{}, fmt.Errorf("mode must be %q or %q, got %q", ModeReject, ModeWarn, spec.Mode)
+	}
+
+	if spec.When != nil {
+		if r.when, err = compileCondition(spec.When); err != nil {
+			return rule{}, fmt.Errorf("when: %w", err)
+		}
+	}
+
+	return r, nil
+}
+
+func compileCondition(w *when) (*condition, error) {
+	field, err := model.ParseJSONPointer(w.Field)
+	if err != nil {
+		return nil, err
+	}
+	if len(field) == 0 {
+		return nil, errors.New("field is required")
+	}
+	for _, token := range field {
+		if token == "*" {
+			return nil, errors.New("condition field cannot contain *")
+		}
+	}
+
+	set := 0
+	c := &condition{field: field, present: w.Present}
+	if w.Equals != nil {
+		set++
+		c.values = valueSet([]any{w.Equals})
+	}
+	if len(w.In) > 0 {
+		set++
+		c.values = valueSet(w.In)
+	}
+	if w.Present != nil {
+		set++
+	}
+	if set != 1 {
+		return nil, errors.New("exactly one of equals, in and present must be set")
+	}
+
+	return c, nil
+}
+
+// Проверяет заказ правилами набора. Нарушения правил в режиме warn добавляются в warnings
+func (s *Set) Check(order *model.Order, verr, warnings *model.ValidationError) error {
+	if len(s.rules) == 0 {
+		return nil
+	}
+
+	doc, err := toDocument(order)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range s.rules {
+		if r.when != nil && !r.when.matches(doc) {
+			continue
+		}
+
+		target := verr
+		if r.warn {
+			target = warnings
+		}
+		walk(doc, r.field, nil, func(path []any, value any, found bool) {
+			if code, message, ok := r.check(value, found); !ok {
+				if r.code != "" {
+					code = r.code
+				}
+				if r.message != "" {
+					message = r.message
+				}
+				target.Add(code, message, path...)
+			}
+		})
+	}
+
+	return nil
+}
+
+// Возвращает код и описание нарушения, если значение не проходит правило
+func (r rule) check(value any, found bool) (string, string, bool) {
+	if isEmpty(value, found) {
+		if r.required {
+			return model.ViolationRequired, "field is required", false
+		}
+		// Остальные проверки относятся только к заполненным полям
+		return "", "", true
+	}
+
+	if r.pattern != nil && !r.pattern.MatchString(scalarString(value)) {
+		return model.ViolationPattern, fmt.Sprintf("must match pattern %s", r.pattern), false
+	}
+
+	if r.enum != nil && !r.enum[scalarString(value)] {
+		return model.ViolationNotAllowed, fmt.Sprintf("value %s is not allowed", scalarString(value)), false
+	}
+
+	if r.min != nil || r.max != nil {
+		n, ok := number(value)
+		switch {
+		case !ok:
+			return model.ViolationOutOfRange, "must be a number", false
+		case r.min != nil && n < *r.min:
+			return model.ViolationOutOfRange, fmt.Sprintf("must be at least %v", *r.min), false
+		case r.max != nil && n > *r.max:
+			return model.ViolationOutOfRange, fmt.Sprintf("must be at most %v", *r.max), false
+		}
+	}
+
+	return "", "", true
+}
+
+func (c *condition) matches(doc any) bool {
+	var value any
+	found := false
+	walk(doc, c.field, nil, func(_ []any, v any, ok bool) {
+		value, found = v, ok
+	})
+
+	if c.present != nil {
+		return *c.present != isEmpty(value, found)
+	}
+	return !isEmpty(value, found) && c.values[scalarString(value)]
+}
+
+// Заказ проверяется в том виде, в котором он передается в JSON, поэтому
+// пути в правилах совпадают с путями в сообщениях и ошибках проверки
+func toDocument(order *model.Order) (any, error) {
+	data, err := json.Marshal(order)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal order for validation rules: %w", err)
+	}
+
+	var doc any
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal order for validation rules: %w", err)
+	}
+	return doc, nil
+}
+
+// Вызывает fn для каждого поля, на которое указывает путь. * перебирает элементы массива.
+// Для отсутствующего поля fn вызывается с found=false, чтобы его можно было проверить на обязательность
+func walk(doc any, tokens []string, path []any, fn func(path []any, value any, found bool)) {
+	if len(tokens) == 0 {
+		fn(path, doc, true)
+		return
+	}
+
+	token, rest := tokens[0], tokens[1:]
+	switch node := doc.(type) {
+	case map[string]any:
+		value, ok := node[token]
+		if !ok {
+			fn(missingPath(path, tokens), nil, false)
+			return
+		}
+		walk(value, rest, append(path, token), fn)
+	case []any:
+		if token == "*" {
+			for i, elem := range node {
+				walk(elem, rest, append(path[:len(path):len(path)], i), fn)
+			}
+			return
+		}
+		i, err := strconv.Atoi(token)
+		if err != nil || i < 0 || i >= len(node) {
+			fn(missingPath(path, tokens), nil, false)
+			return
+		}
+		walk(node[i], rest, append(path, i), fn)
+	default:
+		fn(missingPath(path, tokens), nil, false)
+	}
+}
+
+func missingPath(path []any, tokens []string) []any {
+	full := make([]any, 0, len(path)+len(tokens))
+	full = append(full, path...)
+	for _, token := range tokens {
+		full = append(full, token)
+	}
+	return full
+}
+
+// Пустыми считаются отсутствующее поле, null, пустая строка, ноль и пустой массив:
+// в JSON заказа поля всегда присутствуют, и незаполненное поле передается нулевым значением
+func isEmpty(value any, found bool) bool {
+	if !found || value == nil {
+		return true
+	}
+	switch v := value.(type) {
+	case string:
+		return v == ""
+	case json.Number:
+		n, err := v.Float64()
+		return err == nil && n == 0
+	case []any:
+		return len(v) == 0
+	case map[string]any:
+		return len(v) == 0
+	}
+	return false
+}
+
+// Приводит значение к строке для сравнения со значениями из файла правил
+func scalarString(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
+
+func number(value any) (float64, bool) {
+	if n, ok := value.(json.Number); ok {
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func valueSet(values []any) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[scalarString(v)] = true
+	}
+	return set
+}
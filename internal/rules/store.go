@@ -0,0 +1,55 @@
+package rules
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"orders-service/internal/app/model"
+)
+
+// Правила из файла, которые можно перечитать без перезапуска сервиса.
+// Если новый файл не проходит проверку, продолжают действовать прежние правила
+type Store struct {
+	path    string
+	current atomic.Pointer[Set]
+	// Не дает двум перезагрузкам одновременно заменить правила в неверном порядке
+	reloadMu sync.Mutex
+}
+
+// Загружает правила из файла. Ошибка в файле при запуске останавливает сервис
+func NewStore(path string) (*Store, error) {
+	set, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Store{path: path}
+	s.current.Store(set)
+	return s, nil
+}
+
+func (s *Store) Path() string {
+	return s.path
+}
+
+func (s *Store) Current() *Set {
+	return s.current.Load()
+}
+
+// Перечитывает файл и возвращает новый набор правил
+func (s *Store) Reload() (*Set, error) {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	set, err := Load(s.path)
+	if err != nil {
+		return nil, err
+	}
+	s.current.Store(set)
+	return set, nil
+}
+
+// Проверяет заказ текущими правилами
+func (s *Store) Check(order *model.Order, verr, warnings *model.ValidationError) error {
+	return s.Current().Check(order, verr, warnings)
+}
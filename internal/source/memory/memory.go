@@ -0,0 +1,74 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"orders-service/internal/source"
+)
+
+// Источник, читающий сообщения из канала в памяти. Нужен, чтобы гонять
+// обработку заказов без брокера, например в интеграционных тестах
+type Source struct {
+	topic  string
+	values <-chan []byte
+
+	mu        sync.Mutex
+	next      int64
+	committed int64
+}
+
+// Создает источник, который отдает значения из канала как сообщения топика topic
+// с оффсетами по порядку. После закрытия канала источник исчерпан
+func New(topic string, values <-chan []byte) *Source {
+	return &Source{
+		topic:     topic,
+		values:    values,
+		committed: -1,
+	}
+}
+
+func (s *Source) Fetch(ctx context.Context) (source.Message, error) {
+	select {
+	case <-ctx.Done():
+		return source.Message{}, ctx.Err()
+	case value, ok := <-s.values:
+		if !ok {
+			return source.Message{}, source.ErrExhausted
+		}
+
+		s.mu.Lock()
+		offset := s.next
+		s.next++
+		s.mu.Unlock()
+
+		return source.Message{
+			Topic:  s.topic,
+			Offset: offset,
+			Value:  value,
+			Time:   time.Now(),
+		}, nil
+	}
+}
+
+func (s *Source) Commit(_ context.Context, msgs ...source.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, m := range msgs {
+		s.committed = max(s.committed, m.Offset)
+	}
+	return nil
+}
+
+// Возвращает последний закоммиченный оффсет или -1, если коммитов еще не было
+func (s *Source) Committed() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.committed
+}
+
+func (s *Source) Close() error {
+	return nil
+}
@@ -0,0 +1,39 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Источник исчерпан: новых сообщений больше не будет
+var ErrExhausted = errors.New("order source is exhausted")
+
+type Header struct {
+	Key   string
+	Value []byte
+}
+
+// Сообщение из источника заказов. Offset растет внутри пары Topic/Partition
+// и определяет порядок коммита
+type Message struct {
+	Topic         string
+	Partition     int
+	Offset        int64
+	HighWaterMark int64
+	Key           []byte
+	Value         []byte
+	Headers       []Header
+	Time          time.Time
+}
+
+// Источник сообщений с заказами: Kafka, каталог с NDJSON файлами или канал в памяти
+type OrderSource interface {
+	// Возвращает следующее сообщение, ожидая его появления. После отмены контекста
+	// возвращает context.Canceled, а если сообщений больше не будет - ErrExhausted
+	Fetch(ctx context.Context) (Message, error)
+	// Подтверждает обработку сообщений: после рестарта они и все сообщения до них
+	// в той же партиции больше не будут прочитаны
+	Commit(ctx context.Context, msgs ...Message) error
+	Close() error
+}
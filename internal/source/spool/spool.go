@@ -0,0 +1,302 @@
+package spool
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"orders-service/internal/source"
+)
+
+const (
+	fileExt      = ".ndjson"
+	processedDir = "processed"
+)
+
+// Источник, который читает сообщения построчно из NDJSON файлов в каталоге.
+// Файлы читаются по порядку имен, последний файл дочитывается по мере того, как в него
+// дописывают строки. Позиция каждого файла хранится рядом с ним в скрытом файле
+// .<имя>.offset, а полностью обработанные файлы переносятся в подкаталог processed
+type Source struct {
+	dir          string
+	pollInterval time.Duration
+
+	file   *os.File
+	reader *bufio.Reader
+	pos    int64
+
+	mu      sync.Mutex
+	current string
+}
+
+func New(dir string, pollInterval time.Duration) (*Source, error) {
+	if err := os.MkdirAll(filepath.Join(dir, processedDir), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create spool directory: %w", err)
+	}
+
+	return &Source{
+		dir:          dir,
+		pollInterval: pollInterval,
+	}, nil
+}
+
+// Возвращает следующую строку как сообщение: Topic - имя файла,
+// Offset - позиция в файле сразу после строки
+func (s *Source) Fetch(ctx context.Context) (source.Message, error) {
+	for {
+		if s.file == nil {
+			opened, err := s.openNext()
+			if err != nil {
+				return source.Message{}, err
+			}
+			if !opened {
+				if err := s.wait(ctx); err != nil {
+					return source.Message{}, err
+				}
+				continue
+			}
+		}
+
+		line, err := s.reader.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return source.Message{}, fmt.Errorf("failed to read spool file %s: %w", s.currentName(), err)
+		}
+
+		if err != nil {
+			newer, err := s.hasNewerFile()
+			if err != nil {
+				return source.Message{}, err
+			}
+
+			if !newer {
+				// Строка может быть еще не дописана: возвращаемся к ее началу и ждем
+				if len(line) > 0 {
+					if err := s.seek(s.pos); err != nil {
+						return source.Message{}, err
+					}
+				}
+				if err := s.wait(ctx); err != nil {
+					return source.Message{}, err
+				}
+				continue
+			}
+
+			// В файл, за которым уже есть более новый, больше не пишут: переходим к следующему.
+			// Последняя строка без перевода строки при этом считается полной
+			if len(line) == 0 {
+				s.closeFile()
+				continue
+			}
+		}
+
+		s.pos += int64(len(line))
+		value := bytes.TrimSpace(line)
+		if len(value) == 0 {
+			continue
+		}
+
+		return source.Message{
+			Topic:  s.currentName(),
+			Offset: s.pos,
+			Value:  value,
+			Time:   time.Now(),
+		}, nil
+	}
+}
+
+// Сохраняет позицию каждого файла и переносит в processed файлы,
+// которые полностью обработаны и уже не читаются
+func (s *Source) Commit(_ context.Context, msgs ...source.Message) error {
+	positions := make(map[string]int64)
+	for _, m := range msgs {
+		positions[m.Topic] = max(positions[m.Topic], m.Offset)
+	}
+
+	for name, pos := range positions {
+		info, err := os.Stat(filepath.Join(s.dir, name))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to stat spool file %s: %w", name, err)
+		}
+
+		if err := s.writeOffset(name, pos); err != nil {
+			return err
+		}
+
+		if pos >= info.Size() && name != s.currentName() {
+			if err := s.moveProcessed(name); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *Source) Close() error {
+	s.closeFile()
+	return nil
+}
+
+// Открывает следующий по имени файл с необработанными строками. Последний файл
+// открывается, даже если он дочитан, чтобы дождаться новых строк
+func (s *Source) openNext() (bool, error) {
+	names, err := s.listFiles()
+	if err != nil {
+		return false, err
+	}
+
+	previous := s.currentName()
+	for i, name := range names {
+		if name <= previous {
+			continue
+		}
+
+		pos, err := s.readOffset(name)
+		if err != nil {
+			return false, err
+		}
+		info, err := os.Stat(filepath.Join(s.dir, name))
+		if err != nil {
+			return false, fmt.Errorf("failed to stat spool file %s: %w", name, err)
+		}
+
+		if pos >= info.Size() && i < len(names)-1 {
+			if err := s.moveProcessed(name); err != nil {
+				return false, err
+			}
+			continue
+		}
+
+		file, err := os.Open(filepath.Join(s.dir, name))
+		if err != nil {
+			return false, fmt.Errorf("failed to open spool file %s: %w", name, err)
+		}
+
+		s.mu.Lock()
+		s.current = name
+		s.mu.Unlock()
+		s.file = file
+		s.reader = bufio.NewReader(file)
+		if err := s.seek(pos); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func (s *Source) hasNewerFile() (bool, error) {
+	names, err := s.listFiles()
+	if err != nil {
+		return false, err
+	}
+	return len(names) > 0 && names[len(names)-1] > s.currentName(), nil
+}
+
+func (s *Source) listFiles() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list spool directory: %w", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.Type().IsRegular() && strings.HasSuffix(name, fileExt) && !strings.HasPrefix(name, ".") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+func (s *Source) seek(pos int64) error {
+	if _, err := s.file.Seek(pos, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek spool file %s: %w", s.currentName(), err)
+	}
+	s.reader.Reset(s.file)
+	s.pos = pos
+	return nil
+}
+
+// Закрывает текущий файл, но запоминает его имя, чтобы дальше читать только более новые
+func (s *Source) closeFile() {
+	if s.file != nil {
+		s.file.Close()
+		s.file = nil
+		s.reader = nil
+	}
+}
+
+func (s *Source) currentName() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.current
+}
+
+func (s *Source) wait(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(s.pollInterval):
+		return nil
+	}
+}
+
+func (s *Source) offsetPath(name string) string {
+	return filepath.Join(s.dir, "."+name+".offset")
+}
+
+func (s *Source) readOffset(name string) (int64, error) {
+	data, err := os.ReadFile(s.offsetPath(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read offset of spool file %s: %w", name, err)
+	}
+
+	pos, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid offset of spool file %s: %w", name, err)
+	}
+	return pos, nil
+}
+
+// Записывает позицию через временный файл, чтобы при падении не остался обрезанный оффсет
+func (s *Source) writeOffset(name string, pos int64) error {
+	tmp := s.offsetPath(name) + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strconv.FormatInt(pos, 10)), 0o644); err != nil {
+		return fmt.Errorf("failed to write offset of spool file %s: %w", name, err)
+	}
+	if err := os.Rename(tmp, s.offsetPath(name)); err != nil {
+		return fmt.Errorf("failed to write offset of spool file %s: %w", name, err)
+	}
+	return nil
+}
+
+func (s *Source) moveProcessed(name string) error {
+	err := os.Rename(filepath.Join(s.dir, name), filepath.Join(s.dir, processedDir, name))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to move processed spool file %s: %w", name, err)
+	}
+	if err := os.Remove(s.offsetPath(name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove offset of spool file %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS failed_messages (
+    id BIGSERIAL PRIMARY KEY,
+    topic TEXT NOT NULL,
+    kafka_partition INTEGER NOT NULL,
+    kafka_offset BIGINT NOT NULL,
+    payload BYTEA NOT NULL,
+    failure_kind TEXT NOT NULL,
+    error TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (topic, kafka_partition, kafka_offset)
+);
+
+CREATE INDEX IF NOT EXISTS failed_messages_status_idx ON failed_messages (status, id);
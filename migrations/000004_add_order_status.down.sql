@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS items_order_uid_chrt_id_idx;
+
+ALTER TABLE orders DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE orders DROP COLUMN IF EXISTS cancelled_at;
+ALTER TABLE orders DROP COLUMN IF EXISTS cancel_reason;
+ALTER TABLE orders DROP COLUMN IF EXISTS status;
@@ -0,0 +1,2 @@
+ALTER TABLE failed_messages DROP COLUMN IF EXISTS schema_version;
+ALTER TABLE failed_messages DROP COLUMN IF EXISTS content_type;
@@ -0,0 +1,2 @@
+ALTER TABLE failed_messages ADD COLUMN IF NOT EXISTS content_type TEXT NOT NULL DEFAULT 'application/json';
+ALTER TABLE failed_messages ADD COLUMN IF NOT EXISTS schema_version INTEGER NOT NULL DEFAULT 1;
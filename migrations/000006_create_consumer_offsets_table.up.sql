@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS consumer_offsets (
+    group_id TEXT NOT NULL,
+    topic TEXT NOT NULL,
+    kafka_partition INTEGER NOT NULL,
+    next_offset BIGINT NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (group_id, topic, kafka_partition)
+);
@@ -0,0 +1 @@
+ALTER TABLE failed_messages DROP COLUMN IF EXISTS validation_errors;